@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+// runAdHocCommand runs module_name against the temporary inventory instead
+// of launching a template, and waits for it like a job.
+func (p *Provisioner) runAdHocCommand(ctx context.Context, ui packersdk.Ui, inventoryID, credentialID int, host string) error {
+	ui.Message(fmt.Sprintf("🚀 Running ad hoc command %s for target_host=%s", p.config.ModuleName, host))
+	commandID, err := p.client.LaunchAdHocCommand(ctx, client.AdHocCommand{
+		InventoryID:  inventoryID,
+		CredentialID: credentialID,
+		ModuleName:   p.config.ModuleName,
+		ModuleArgs:   p.config.ModuleArgs,
+		Become:       p.config.Become,
+		Verbosity:    p.config.Verbosity,
+		ExtraVars:    p.config.ExtraVars,
+	})
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to launch ad hoc command: %s", describeError(err)))
+		return fmt.Errorf("failed to launch ad hoc command: %w", err)
+	}
+	ui.Message(fmt.Sprintf("✅ Ad hoc command launched %s. Waiting for completion...", p.jobURL("command", commandID)))
+
+	ui.Message("⏳ Polling ad hoc command status...")
+	output := &jobOutput{ui: ui}
+	err = p.client.PollAdHocCommand(ctx, commandID, p.pollOptions(ui, output))
+	if output.printed == 0 {
+		output.stdout(p.client.GetAdHocCommandStdout(ctx, commandID))
+	}
+
+	// Ad hoc commands have no host summaries, so the failures come from
+	// the streamed events.
+	var failed *client.JobFailedError
+	if errors.As(err, &failed) {
+		reportTasks(ui, output.failures)
+		ui.Message(fmt.Sprintf("🔗 %s", p.jobURL("command", commandID)))
+		if len(output.failures) > 0 {
+			err = fmt.Errorf("%w on %s", failed, output.failures[0].Host)
+		}
+		ui.Error(fmt.Sprintf("❌ %s", describeError(err)))
+		return err
+	}
+	var timedOut *client.JobTimeoutError
+	if errors.As(err, &timedOut) {
+		ui.Error(fmt.Sprintf("⏰ %s; the command was left on the controller", describeError(err)))
+		return err
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf("❌ %s", describeError(err)))
+		return fmt.Errorf("ad hoc command failed: %w", err)
+	}
+
+	ui.Message("🎉 Ad hoc command completed successfully!")
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+// invalidPKPattern matches AAP's validation message for a related object that does not exist.
+var invalidPKPattern = regexp.MustCompile(`Invalid pk "(\d+)"`)
+
+// describeError renders an actionable message for errors returned by the AAP
+// client. Errors that did not come from the controller are returned as is.
+func describeError(err error) string {
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		return err.Error()
+	}
+
+	resource, id := resourceFromPath(apiErr.Path)
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized:
+		return "authentication with AAP failed: check access_token or username/password"
+	case http.StatusForbidden:
+		access := "write"
+		if apiErr.Method == http.MethodGet {
+			access = "read"
+		}
+		msg := fmt.Sprintf("token lacks %s permission on %s", access, pluralResource(apiErr.Path))
+		if apiErr.Detail != "" {
+			msg += fmt.Sprintf(" (%s)", apiErr.Detail)
+		}
+		return msg
+	case http.StatusNotFound:
+		if id != "" {
+			return fmt.Sprintf("%s %s not found", resource, id)
+		}
+		return fmt.Sprintf("%s not found", resource)
+	case http.StatusConflict:
+		return fmt.Sprintf("%s conflicts with its current state: %s", resource, apiErr.Detail)
+	case http.StatusBadRequest:
+		fields := make([]string, 0, len(apiErr.FieldErrors))
+		for field := range apiErr.FieldErrors {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		var msgs []string
+		for _, field := range fields {
+			for _, m := range apiErr.FieldErrors[field] {
+				if match := invalidPKPattern.FindStringSubmatch(m); match != nil {
+					msgs = append(msgs, fmt.Sprintf("%s %s not found", strings.ReplaceAll(field, "_", " "), match[1]))
+				}
+			}
+		}
+		if len(msgs) > 0 {
+			return strings.Join(msgs, "; ")
+		}
+	}
+	return apiErr.Error()
+}
+
+// resourceFromPath extracts a human readable resource name and, if present,
+// the object ID from an API path such as /api/controller/v2/job_templates/42/launch/.
+func resourceFromPath(path string) (string, string) {
+	segments := apiSegments(path)
+	if len(segments) == 0 {
+		return "resource", ""
+	}
+
+	resource := strings.ReplaceAll(singular(segments[0]), "_", " ")
+	if len(segments) > 1 && strings.Trim(segments[1], "0123456789") == "" {
+		return resource, segments[1]
+	}
+	return resource, ""
+}
+
+// pluralResource returns the collection name of the API path, e.g. "inventories".
+func pluralResource(path string) string {
+	segments := apiSegments(path)
+	if len(segments) == 0 {
+		return "the requested resource"
+	}
+	return segments[0]
+}
+
+// apiSegments returns the path segments following the API version prefix.
+func apiSegments(path string) []string {
+	if i := strings.Index(path, "/v2/"); i >= 0 {
+		path = path[i+len("/v2/"):]
+	}
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// singular converts an API collection name to its singular form.
+func singular(collection string) string {
+	switch {
+	case strings.HasSuffix(collection, "ies"):
+		return strings.TrimSuffix(collection, "ies") + "y"
+	case strings.HasSuffix(collection, "s"):
+		return strings.TrimSuffix(collection, "s")
+	}
+	return collection
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+func TestDescribeError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "not from the controller",
+			err:  errors.New("connection reset"),
+			want: "connection reset",
+		},
+		{
+			name: "unauthorized",
+			err:  &client.APIError{Method: "GET", Path: "/api/controller/v2/me/", StatusCode: 401},
+			want: "authentication with AAP failed: check access_token or username/password",
+		},
+		{
+			name: "forbidden write",
+			err:  &client.APIError{Method: "POST", Path: "/api/controller/v2/inventories/", StatusCode: 403, Detail: "You do not have permission to perform this action."},
+			want: "token lacks write permission on inventories (You do not have permission to perform this action.)",
+		},
+		{
+			name: "forbidden read",
+			err:  &client.APIError{Method: "GET", Path: "/api/controller/v2/job_templates/42/", StatusCode: 403},
+			want: "token lacks read permission on job_templates",
+		},
+		{
+			name: "invalid pk",
+			err: &client.APIError{Method: "POST", Path: "/api/controller/v2/inventories/", StatusCode: 400, FieldErrors: map[string][]string{
+				"organization": {`Invalid pk "4" - object does not exist.`},
+			}},
+			want: "organization 4 not found",
+		},
+		{
+			name: "invalid pks of several fields",
+			err: &client.APIError{Method: "POST", Path: "/api/controller/v2/credentials/", StatusCode: 400, FieldErrors: map[string][]string{
+				"organization":    {`Invalid pk "4" - object does not exist.`},
+				"credential_type": {`Invalid pk "17" - object does not exist.`},
+			}},
+			want: "credential type 17 not found; organization 4 not found",
+		},
+		{
+			name: "other validation error",
+			err: &client.APIError{Method: "POST", Path: "/api/controller/v2/hosts/", StatusCode: 400, FieldErrors: map[string][]string{
+				"name": {"Host with this Name and Inventory already exists."},
+			}},
+			want: "POST /api/controller/v2/hosts/ returned 400 Bad Request: name: Host with this Name and Inventory already exists.",
+		},
+		{
+			name: "not found with an ID",
+			err:  &client.APIError{Method: "POST", Path: "/api/controller/v2/job_templates/42/launch/", StatusCode: 404},
+			want: "job template 42 not found",
+		},
+		{
+			name: "not found without an ID",
+			err:  &client.APIError{Method: "GET", Path: "/api/controller/v2/credential_types/", StatusCode: 404},
+			want: "credential type not found",
+		},
+		{
+			name: "conflict",
+			err:  &client.APIError{Method: "DELETE", Path: "/api/controller/v2/inventories/7/", StatusCode: 409, Detail: "Inventory is being used by running jobs."},
+			want: "inventory conflicts with its current state: Inventory is being used by running jobs.",
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("failed to create host: %w", &client.APIError{Method: "POST", Path: "/api/controller/v2/inventories/7/hosts/", StatusCode: 404}),
+			want: "inventory 7 not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeError(tt.err); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResourceFromPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		resource string
+		id       string
+	}{
+		{path: "/api/controller/v2/job_templates/42/launch/", resource: "job template", id: "42"},
+		{path: "/api/controller/v2/inventories/7/", resource: "inventory", id: "7"},
+		{path: "/api/controller/v2/credential_types/?name=Machine", resource: "credential type"},
+		{path: "/api/controller/v2/", resource: "resource"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resource, id := resourceFromPath(tt.path)
+			if resource != tt.resource || id != tt.id {
+				t.Errorf("Expected %q %q, got %q %q", tt.resource, tt.id, resource, id)
+			}
+		})
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := map[string]string{
+		"inventories":   "inventory",
+		"job_templates": "job_template",
+		"hosts":         "host",
+		"me":            "me",
+	}
+	for collection, want := range tests {
+		if got := singular(collection); got != want {
+			t.Errorf("Expected singular(%q) = %q, got %q", collection, want, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+// ansiPattern matches the color escapes in the controller's event output.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// jobOutput prints the events of a running job to the Packer UI.
+type jobOutput struct {
+	ui packersdk.Ui
+	// printed counts the events that had output.
+	printed int
+	// queued is the last reported queue state.
+	queued client.QueueInfo
+	// failures are the failed and unreachable host events seen so far.
+	failures []client.JobEvent
+}
+
+// queue reports where a waiting job stands, whenever that changes.
+func (o *jobOutput) queue(info client.QueueInfo) {
+	if info == o.queued {
+		return
+	}
+	o.queued = info
+
+	var details []string
+	if info.Position > 0 {
+		details = append(details, fmt.Sprintf("position %d in the queue", info.Position))
+	}
+	if info.InstanceGroup != "" {
+		details = append(details, "instance group "+info.InstanceGroup)
+	} else {
+		details = append(details, "no instance group with capacity yet")
+	}
+	o.ui.Message(fmt.Sprintf("⏳ Job is %s (%s)", info.Status, strings.Join(details, ", ")))
+}
+
+// event prints the output of a job event, such as a task header or a host
+// result, without color escapes.
+func (o *jobOutput) event(e client.JobEvent) {
+	if failure(e) {
+		o.failures = append(o.failures, e)
+	}
+	stdout := strings.TrimRight(ansiPattern.ReplaceAllString(e.Stdout, ""), "\r\n")
+	if stdout == "" {
+		return
+	}
+	o.printed++
+	o.ui.Message(stdout)
+}
+
+// stdout prints a job's stdout, for controllers that do not keep job events.
+func (o *jobOutput) stdout(stdout string, err error) {
+	if err != nil {
+		o.ui.Message(fmt.Sprintf("⚠️ %s", describeError(err)))
+		return
+	}
+	o.ui.Message(stdout)
+}
+
+// job announces the next job of a workflow.
+func (o *jobOutput) job(jobID int, name string) {
+	o.ui.Message(fmt.Sprintf("▶️ Workflow node job %d: %s", jobID, name))
+}
+
+// jobURL returns the controller UI page showing a job's output. kind is
+// "playbook", "workflow", "command" for ad hoc commands or "project" for
+// project updates.
+func (p *Provisioner) jobURL(kind string, jobID int) string {
+	return fmt.Sprintf("%s/execution/jobs/%s/%d/output/", p.config.TowerHost, kind, jobID)
+}
+
+// maxReportedFailures bounds how many failed tasks a failure report lists.
+const maxReportedFailures = 5
+
+// reportFailure prints the play recap of a failed job and the tasks that
+// failed, and returns the first failed task. It returns nil if the job has
+// no failed host events, e.g. when the playbook could not be parsed.
+func (p *Provisioner) reportFailure(ctx context.Context, ui packersdk.Ui, jobID int) *client.JobEvent {
+	summaries, err := p.client.GetJobHostSummaries(ctx, jobID)
+	if err != nil {
+		ui.Message(fmt.Sprintf("⚠️ Failed to fetch the play recap: %s", describeError(err)))
+	} else if len(summaries) > 0 {
+		width := 0
+		for _, s := range summaries {
+			width = max(width, len(s.Host))
+		}
+		ui.Message("📋 Play recap:")
+		for _, s := range summaries {
+			ui.Message(fmt.Sprintf("   %-*s : ok=%d changed=%d unreachable=%d failed=%d skipped=%d rescued=%d ignored=%d",
+				width, s.Host, s.Ok, s.Changed, s.Unreachable, s.Failures, s.Skipped, s.Rescued, s.Ignored))
+		}
+	}
+
+	events, err := p.client.GetFailedJobEvents(ctx, jobID)
+	if err != nil {
+		ui.Message(fmt.Sprintf("⚠️ Failed to fetch the failed tasks: %s", describeError(err)))
+	}
+	var failures []client.JobEvent
+	for _, e := range events {
+		if failure(e) {
+			failures = append(failures, e)
+		}
+	}
+	reportTasks(ui, failures)
+	ui.Message(fmt.Sprintf("🔗 %s", p.jobURL("playbook", jobID)))
+
+	if len(failures) == 0 {
+		return nil
+	}
+	return &failures[0]
+}
+
+// failure reports whether an event is a host failure the playbook did not
+// ignore.
+func failure(e client.JobEvent) bool {
+	if e.Event != "runner_on_failed" && e.Event != "runner_on_unreachable" {
+		return false
+	}
+	return !e.IgnoredError()
+}
+
+// reportTasks prints failed host events with an excerpt of their output.
+func reportTasks(ui packersdk.Ui, failures []client.JobEvent) {
+	for i, e := range failures {
+		if i == maxReportedFailures {
+			ui.Message(fmt.Sprintf("   ... and %d more", len(failures)-i))
+			break
+		}
+		outcome := "failed"
+		if e.Event == "runner_on_unreachable" {
+			outcome = "unreachable"
+		}
+		var details []string
+		if e.Role != "" {
+			details = append(details, "role: "+e.Role)
+		}
+		if module := e.Module(); module != "" {
+			details = append(details, "module: "+module)
+		}
+		task := fmt.Sprintf("Task %q", e.Task)
+		if e.Task == "" {
+			// Ad hoc commands run a module without a task.
+			task = "Command"
+		}
+		line := fmt.Sprintf("❌ %s %s on %s", task, outcome, e.Host)
+		if len(details) > 0 {
+			line += fmt.Sprintf(" (%s)", strings.Join(details, ", "))
+		}
+		ui.Message(line)
+
+		res := e.Result()
+		for _, key := range []string{"msg", "stderr"} {
+			if value, ok := res[key]; ok {
+				if text := excerpt(fmt.Sprint(value)); text != "" {
+					ui.Message(fmt.Sprintf("   %s: %s", key, text))
+				}
+			}
+		}
+	}
+}
+
+// excerpt shortens module output to a few lines for the failure report.
+func excerpt(text string) string {
+	const maxLines, maxLen = 5, 400
+	text = strings.TrimSpace(ansiPattern.ReplaceAllString(text, ""))
+	lines := strings.Split(text, "\n")
+	truncated := false
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		truncated = true
+	}
+	text = strings.Join(lines, "\n     ")
+	if runes := []rune(text); len(runes) > maxLen {
+		text = string(runes[:maxLen])
+		truncated = true
+	}
+	if truncated {
+		text += " ..."
+	}
+	return text
+}
+
+// jobAttempt is one launch of a job that was retried.
+type jobAttempt struct {
+	JobID   int
+	Outcome client.JobOutcome
+	// Task is the first failed task, if known.
+	Task *client.JobEvent
+}
+
+// reportAttempts prints the outcome of every attempt of a retried job.
+func reportAttempts(ui packersdk.Ui, attempts []jobAttempt) {
+	ui.Message(fmt.Sprintf("📋 Attempts (%d):", len(attempts)))
+	for i, a := range attempts {
+		line := fmt.Sprintf("   %d. job %d %s", i+1, a.JobID, a.Outcome)
+		if a.Task != nil {
+			line += fmt.Sprintf(" at task %q on %s", a.Task.Task, a.Task.Host)
+		}
+		ui.Message(line)
+	}
+}
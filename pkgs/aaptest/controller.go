@@ -0,0 +1,1122 @@
+// Package aaptest provides an in-memory fake of the AAP controller for tests.
+//
+// Controller implements client.API. It keeps inventories, hosts, groups,
+// credentials, credential types, job templates and jobs in memory, walks
+// launched jobs through a configurable list of states, and lets tests inject
+// failures into any operation.
+package aaptest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/internal/jobclock"
+)
+
+// Inventory is a temporary inventory created through the fake.
+type Inventory struct {
+	ID             int
+	Name           string
+	OrganizationID int
+	Vars           map[string]interface{}
+}
+
+// Host is a host added to an inventory through the fake.
+type Host struct {
+	ID          int
+	InventoryID int
+	Details     client.HostDetails
+	// Vars are the host variables the real client would send.
+	Vars map[string]interface{}
+}
+
+// Group is a group created in an inventory through the fake.
+type Group struct {
+	ID          int
+	InventoryID int
+	Name        string
+	Vars        map[string]interface{}
+	HostIDs     []int
+}
+
+// Credential is a credential known to the fake, either created by the code
+// under test or registered beforehand with AddCredential.
+type Credential struct {
+	ID               int
+	Name             string
+	OrganizationID   int
+	CredentialTypeID int
+	Kind             string
+	Inputs           map[string]interface{}
+
+	temporary bool
+}
+
+func (cred *Credential) client() client.Credential {
+	vaultID, _ := cred.Inputs["vault_id"].(string)
+	return client.Credential{
+		ID:               cred.ID,
+		Name:             cred.Name,
+		CredentialTypeID: cred.CredentialTypeID,
+		Kind:             cred.Kind,
+		VaultID:          vaultID,
+	}
+}
+
+// CredentialType is a custom credential type created through the fake.
+type CredentialType struct {
+	ID         int
+	Definition client.CredentialTypeDefinition
+}
+
+// JobTemplate is a temporary job template created through the fake.
+type JobTemplate struct {
+	ID               int
+	Name             string
+	Template         client.JobTemplate
+	InstanceGroupIDs []int
+}
+
+// Event is a single job event emitted by a fake job.
+type Event struct {
+	Counter int
+	Event   string
+	Host    string
+	Task    string
+	Role    string
+	Stdout  string
+	Failed  bool
+	// Data is the event's event_data, e.g. task_action and res.
+	Data map[string]interface{}
+}
+
+func (e Event) client(counter int) client.JobEvent {
+	if e.Counter != 0 {
+		counter = e.Counter
+	}
+	return client.JobEvent{
+		Counter: counter,
+		Event:   e.Event,
+		Host:    e.Host,
+		Task:    e.Task,
+		Role:    e.Role,
+		Stdout:  e.Stdout,
+		Failed:  e.Failed,
+		Data:    e.Data,
+	}
+}
+
+// Job is a job or workflow job launched through the fake.
+type Job struct {
+	ID                 int
+	InventoryID        int
+	JobTemplateID      int
+	WorkflowTemplateID int
+	CredentialIDs      []int
+	ExtraVars          map[string]interface{}
+	// States lists the statuses the job goes through, one per poll. The last
+	// entry is the final status.
+	States []string
+	// Status is the status the job reached on the last poll.
+	Status string
+	Events []Event
+	// Stdout overrides the output derived from Events.
+	Stdout        string
+	HostSummaries []client.HostSummary
+	// Explanation is the job_explanation reported when the job finishes.
+	Explanation string
+	// QueuePosition and InstanceGroup are reported while the job is queued.
+	QueuePosition int
+	InstanceGroup string
+	// RelaunchOf is the job this job relaunched, and RelaunchHosts the hosts
+	// it was relaunched on.
+	RelaunchOf    int
+	RelaunchHosts string
+	// AdHoc is set for ad hoc commands.
+	AdHoc *client.AdHocCommand
+	// ProjectID is set for project updates to the project they sync, and
+	// ScmRevision to the revision they checked out.
+	ProjectID   int
+	ScmRevision string
+
+	streamed int
+}
+
+// JobScript describes how the next launched job behaves.
+type JobScript struct {
+	States        []string
+	Events        []Event
+	Stdout        string
+	HostSummaries []client.HostSummary
+	Explanation   string
+	QueuePosition int
+	InstanceGroup string
+	// ScmRevision is the revision a project update checks out. It defaults
+	// to the project's scm_revision.
+	ScmRevision string
+}
+
+// apply sets up job to behave as scripted.
+func (s JobScript) apply(job *Job) {
+	job.States = append([]string(nil), s.States...)
+	job.Events = append([]Event(nil), s.Events...)
+	job.Stdout = s.Stdout
+	job.HostSummaries = append([]client.HostSummary(nil), s.HostSummaries...)
+	job.Explanation = s.Explanation
+	job.QueuePosition = s.QueuePosition
+	job.InstanceGroup = s.InstanceGroup
+}
+
+// Controller is an in-memory fake AAP controller.
+type Controller struct {
+	mu sync.Mutex
+
+	nextID int
+	marker string
+
+	Inventories     map[int]*Inventory
+	Hosts           map[int]*Host
+	Groups          map[int]*Group
+	Credentials     map[int]*Credential
+	CredentialTypes map[string]int
+	Jobs            map[int]*Job
+	JobTemplates    map[int]*JobTemplate
+
+	// CreatedHosts and CreatedGroups list every host and group created
+	// through the fake in order, including those deleted since, so tests
+	// can inspect them after cleanup.
+	CreatedHosts  []*Host
+	CreatedGroups []*Group
+
+	// Projects maps project names to IDs for FindProject.
+	Projects map[string]int
+	// ProjectSources holds the projects returned by GetProject and synced
+	// by UpdateProject.
+	ProjectSources map[int]*client.Project
+	// TemplateProjects maps job template IDs to their project IDs. Templates
+	// created through the fake use the project they were created with.
+	TemplateProjects map[int]int
+
+	// CredentialTypeKinds maps credential type names to their kind (e.g.
+	// "ssh", "vault", "cloud"). Lookups by kind only match types listed here.
+	CredentialTypeKinds map[string]string
+
+	// CreatedCredentialTypes holds custom credential types created through the fake.
+	CreatedCredentialTypes map[int]*CredentialType
+
+	// TemplateCredentials maps job template IDs to their default credential IDs.
+	TemplateCredentials map[int][]int
+
+	// Script controls jobs launched from now on. By default jobs go through
+	// pending and running and end up successful.
+	Script JobScript
+	// Relaunches controls relaunched jobs, one entry per relaunch, before
+	// they fall back to Script.
+	Relaunches []JobScript
+	// AdHocScripts controls ad hoc commands, one entry per launch, before
+	// they fall back to Script.
+	AdHocScripts []JobScript
+	// ProjectUpdates controls project updates, one entry per update, before
+	// they fall back to Script.
+	ProjectUpdates []JobScript
+
+	// Calls records every operation in the order it was invoked.
+	Calls []string
+
+	failures map[string][]failure
+}
+
+type failure struct {
+	err  error
+	once bool
+}
+
+// NewController returns a fake controller seeded with the built-in Machine and Vault credential types.
+func NewController() *Controller {
+	c := &Controller{
+		nextID:          100,
+		marker:          "aaptest",
+		Inventories:     make(map[int]*Inventory),
+		Hosts:           make(map[int]*Host),
+		Groups:          make(map[int]*Group),
+		Credentials:     make(map[int]*Credential),
+		CredentialTypes: make(map[string]int),
+		Jobs:            make(map[int]*Job),
+		JobTemplates:    make(map[int]*JobTemplate),
+		Projects:        make(map[string]int),
+		ProjectSources:  make(map[int]*client.Project),
+
+		CredentialTypeKinds:    make(map[string]string),
+		CreatedCredentialTypes: make(map[int]*CredentialType),
+		TemplateCredentials:    make(map[int][]int),
+		TemplateProjects:       make(map[int]int),
+		Script: JobScript{
+			States: []string{"pending", "running", "successful"},
+		},
+		failures: make(map[string][]failure),
+	}
+	c.CredentialTypes["Machine"] = 1
+	c.CredentialTypes["Vault"] = 3
+	c.CredentialTypeKinds["Machine"] = "ssh"
+	c.CredentialTypeKinds["Vault"] = "vault"
+	return c
+}
+
+var _ client.API = (*Controller)(nil)
+
+// Fail makes every subsequent call to op return err.
+func (c *Controller) Fail(op string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[op] = append(c.failures[op], failure{err: err})
+}
+
+// FailOnce makes the next call to op return err.
+func (c *Controller) FailOnce(op string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[op] = append(c.failures[op], failure{err: err, once: true})
+}
+
+// Called reports how many times op was invoked.
+func (c *Controller) Called(op string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, call := range c.Calls {
+		if call == op {
+			n++
+		}
+	}
+	return n
+}
+
+// call records op and returns an injected failure, if any. The caller must hold c.mu.
+func (c *Controller) call(op string) error {
+	c.Calls = append(c.Calls, op)
+	fs := c.failures[op]
+	if len(fs) == 0 {
+		return nil
+	}
+	f := fs[0]
+	if f.once {
+		c.failures[op] = fs[1:]
+	}
+	return f.err
+}
+
+func (c *Controller) id() int {
+	c.nextID++
+	return c.nextID
+}
+
+func (c *Controller) RunMarker() string {
+	return c.marker
+}
+
+func (c *Controller) CreateInventory(_ context.Context, orgID int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateInventory"); err != nil {
+		return 0, err
+	}
+	inv := &Inventory{ID: c.id(), Name: "packer-inv-" + c.marker, OrganizationID: orgID}
+	c.Inventories[inv.ID] = inv
+	return inv.ID, nil
+}
+
+func (c *Controller) DeleteInventory(_ context.Context, invID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteInventory"); err != nil {
+		return err
+	}
+	if _, ok := c.Inventories[invID]; !ok {
+		return notFound("DELETE", fmt.Sprintf("/api/controller/v2/inventories/%d/", invID))
+	}
+	delete(c.Inventories, invID)
+	for id, h := range c.Hosts {
+		if h.InventoryID == invID {
+			delete(c.Hosts, id)
+		}
+	}
+	for id, g := range c.Groups {
+		if g.InventoryID == invID {
+			delete(c.Groups, id)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) UpdateInventoryVariables(_ context.Context, invID int, vars map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("UpdateInventoryVariables"); err != nil {
+		return err
+	}
+	inv, ok := c.Inventories[invID]
+	if !ok {
+		return notFound("PATCH", fmt.Sprintf("/api/controller/v2/inventories/%d/", invID))
+	}
+	inv.Vars = vars
+	return nil
+}
+
+func (c *Controller) CreateHost(_ context.Context, invID int, details client.HostDetails) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateHost"); err != nil {
+		return 0, err
+	}
+	if _, ok := c.Inventories[invID]; !ok {
+		return 0, badRequest("POST", "/api/controller/v2/hosts/", "inventory", invID)
+	}
+	h := &Host{
+		ID:          c.id(),
+		InventoryID: invID,
+		Details:     details,
+		Vars:        client.HostVars(details),
+	}
+	c.Hosts[h.ID] = h
+	c.CreatedHosts = append(c.CreatedHosts, h)
+	return h.ID, nil
+}
+
+func (c *Controller) DeleteHost(_ context.Context, hostID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteHost"); err != nil {
+		return err
+	}
+	if _, ok := c.Hosts[hostID]; !ok {
+		return notFound("DELETE", fmt.Sprintf("/api/controller/v2/hosts/%d/", hostID))
+	}
+	delete(c.Hosts, hostID)
+	return nil
+}
+
+func (c *Controller) CreateGroup(_ context.Context, invID int, name string, vars map[string]interface{}) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateGroup"); err != nil {
+		return 0, err
+	}
+	if _, ok := c.Inventories[invID]; !ok {
+		return 0, badRequest("POST", "/api/controller/v2/groups/", "inventory", invID)
+	}
+	g := &Group{ID: c.id(), InventoryID: invID, Name: name, Vars: vars}
+	c.Groups[g.ID] = g
+	c.CreatedGroups = append(c.CreatedGroups, g)
+	return g.ID, nil
+}
+
+func (c *Controller) AddHostToGroup(_ context.Context, groupID, hostID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("AddHostToGroup"); err != nil {
+		return err
+	}
+	g, ok := c.Groups[groupID]
+	if !ok {
+		return notFound("POST", fmt.Sprintf("/api/controller/v2/groups/%d/hosts/", groupID))
+	}
+	if _, ok := c.Hosts[hostID]; !ok {
+		return badRequest("POST", fmt.Sprintf("/api/controller/v2/groups/%d/hosts/", groupID), "id", hostID)
+	}
+	for _, id := range g.HostIDs {
+		if id == hostID {
+			return nil
+		}
+	}
+	g.HostIDs = append(g.HostIDs, hostID)
+	return nil
+}
+
+func (c *Controller) DeleteGroup(_ context.Context, groupID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteGroup"); err != nil {
+		return err
+	}
+	if _, ok := c.Groups[groupID]; !ok {
+		return notFound("DELETE", fmt.Sprintf("/api/controller/v2/groups/%d/", groupID))
+	}
+	delete(c.Groups, groupID)
+	return nil
+}
+
+// GroupMembers returns the names of the groups the host was added to,
+// sorted, including groups that were deleted since.
+func (c *Controller) GroupMembers(hostID int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for _, g := range c.CreatedGroups {
+		for _, id := range g.HostIDs {
+			if id == hostID {
+				names = append(names, g.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Controller) GetCredentialTypeID(_ context.Context, name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetCredentialTypeID"); err != nil {
+		return 0, err
+	}
+	return c.credentialTypeID(name)
+}
+
+// LookupCredentialType resolves a credential type by name and, if kind is
+// not empty, by the kind recorded in CredentialTypeKinds.
+func (c *Controller) LookupCredentialType(_ context.Context, name, kind string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("LookupCredentialType"); err != nil {
+		return 0, err
+	}
+	id, ok := c.CredentialTypes[name]
+	if kind == "" {
+		return c.credentialTypeID(name)
+	}
+	if !ok || c.CredentialTypeKinds[name] != kind {
+		return 0, fmt.Errorf("%w: '%s' of kind '%s'", client.ErrCredentialTypeNotFound, name, kind)
+	}
+	return id, nil
+}
+
+func (c *Controller) credentialTypeID(name string) (int, error) {
+	id, ok := c.CredentialTypes[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: '%s'", client.ErrCredentialTypeNotFound, name)
+	}
+	return id, nil
+}
+
+func (c *Controller) createCredential(op string, orgID int, name, typeName, kind string, inputs map[string]interface{}) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(op); err != nil {
+		return 0, err
+	}
+	typeID, err := c.credentialTypeID(typeName)
+	if err != nil {
+		return 0, err
+	}
+	cred := &Credential{
+		ID:               c.id(),
+		Name:             fmt.Sprintf("%s-%s", name, c.marker),
+		OrganizationID:   orgID,
+		CredentialTypeID: typeID,
+		Kind:             kind,
+		Inputs:           inputs,
+		temporary:        true,
+	}
+	c.Credentials[cred.ID] = cred
+	return cred.ID, nil
+}
+
+func (c *Controller) CreateCustomCredential(_ context.Context, orgID, credentialTypeID int, inputs map[string]interface{}) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateCustomCredential"); err != nil {
+		return 0, err
+	}
+	kind := "cloud"
+	if ct, ok := c.CreatedCredentialTypes[credentialTypeID]; ok {
+		kind = ct.Definition.Kind
+	}
+	cred := &Credential{
+		ID:               c.id(),
+		Name:             fmt.Sprintf("packer-cred-%d-%s", credentialTypeID, c.marker),
+		OrganizationID:   orgID,
+		CredentialTypeID: credentialTypeID,
+		Kind:             kind,
+		Inputs:           inputs,
+		temporary:        true,
+	}
+	c.Credentials[cred.ID] = cred
+	return cred.ID, nil
+}
+
+func (c *Controller) CreateCredentialType(_ context.Context, def client.CredentialTypeDefinition) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateCredentialType"); err != nil {
+		return 0, err
+	}
+	ct := &CredentialType{ID: c.id(), Definition: def}
+	c.CreatedCredentialTypes[ct.ID] = ct
+	c.CredentialTypes[def.Name] = ct.ID
+	c.CredentialTypeKinds[def.Name] = def.Kind
+	return ct.ID, nil
+}
+
+func (c *Controller) DeleteCredentialType(_ context.Context, credentialTypeID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteCredentialType"); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/api/controller/v2/credential_types/%d/", credentialTypeID)
+	ct, ok := c.CreatedCredentialTypes[credentialTypeID]
+	if !ok {
+		return notFound("DELETE", path)
+	}
+	for _, cred := range c.Credentials {
+		if cred.CredentialTypeID == credentialTypeID {
+			return &client.APIError{Method: "DELETE", Path: path, StatusCode: 409, Detail: "Credential types that are in use cannot be deleted."}
+		}
+	}
+	delete(c.CreatedCredentialTypes, credentialTypeID)
+	delete(c.CredentialTypes, ct.Definition.Name)
+	delete(c.CredentialTypeKinds, ct.Definition.Name)
+	return nil
+}
+
+// AddCredential registers a pre-existing credential and returns its ID.
+// Pre-existing credentials are not reported by Leftovers.
+func (c *Controller) AddCredential(cred Credential) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cred.ID == 0 {
+		cred.ID = c.id()
+	}
+	cred.temporary = false
+	c.Credentials[cred.ID] = &cred
+	return cred.ID
+}
+
+func (c *Controller) GetCredential(_ context.Context, credentialID int) (client.Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetCredential"); err != nil {
+		return client.Credential{}, err
+	}
+	cred, ok := c.Credentials[credentialID]
+	if !ok {
+		return client.Credential{}, notFound("GET", fmt.Sprintf("/api/controller/v2/credentials/%d/", credentialID))
+	}
+	return cred.client(), nil
+}
+
+func (c *Controller) FindCredential(_ context.Context, name string) (client.Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("FindCredential"); err != nil {
+		return client.Credential{}, err
+	}
+	var matches []*Credential
+	for _, cred := range c.Credentials {
+		if cred.Name == name {
+			matches = append(matches, cred)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return client.Credential{}, fmt.Errorf("credential %q not found", name)
+	case 1:
+		return matches[0].client(), nil
+	default:
+		return client.Credential{}, fmt.Errorf("credential name %q is ambiguous (%d matches)", name, len(matches))
+	}
+}
+
+func (c *Controller) GetTemplateCredentials(_ context.Context, jobTemplateID int) ([]client.Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetTemplateCredentials"); err != nil {
+		return nil, err
+	}
+	var creds []client.Credential
+	for _, id := range c.TemplateCredentials[jobTemplateID] {
+		if cred, ok := c.Credentials[id]; ok {
+			creds = append(creds, cred.client())
+		}
+	}
+	return creds, nil
+}
+
+func (c *Controller) CreateMachineCredential(_ context.Context, orgID int, cred client.MachineCredential) (int, error) {
+	return c.createCredential("CreateMachineCredential", orgID, "packer-machine-cred", "Machine", "ssh", cred.Inputs())
+}
+
+func (c *Controller) CreateVaultCredential(_ context.Context, orgID int, vaultPassword, vaultID string) (int, error) {
+	inputs := map[string]interface{}{"vault_password": vaultPassword}
+	if vaultID != "" {
+		inputs["vault_id"] = vaultID
+	}
+	return c.createCredential("CreateVaultCredential", orgID, "packer-vault-cred", "Vault", "vault", inputs)
+}
+
+func (c *Controller) DeleteCredential(_ context.Context, credentialID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteCredential"); err != nil {
+		return err
+	}
+	if _, ok := c.Credentials[credentialID]; !ok {
+		return notFound("DELETE", fmt.Sprintf("/api/controller/v2/credentials/%d/", credentialID))
+	}
+	delete(c.Credentials, credentialID)
+	return nil
+}
+
+func (c *Controller) FindProject(_ context.Context, name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("FindProject"); err != nil {
+		return 0, err
+	}
+	id, ok := c.Projects[name]
+	if !ok {
+		return 0, fmt.Errorf("project %q not found", name)
+	}
+	return id, nil
+}
+
+func (c *Controller) GetProject(_ context.Context, projectID int) (client.Project, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetProject"); err != nil {
+		return client.Project{}, err
+	}
+	project, ok := c.ProjectSources[projectID]
+	if !ok {
+		return client.Project{}, notFound("GET", fmt.Sprintf("/api/controller/v2/projects/%d/", projectID))
+	}
+	return *project, nil
+}
+
+func (c *Controller) GetJobTemplateProject(_ context.Context, jobTemplateID int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetJobTemplateProject"); err != nil {
+		return 0, err
+	}
+	if jt, ok := c.JobTemplates[jobTemplateID]; ok {
+		return jt.Template.ProjectID, nil
+	}
+	id, ok := c.TemplateProjects[jobTemplateID]
+	if !ok {
+		return 0, notFound("GET", fmt.Sprintf("/api/controller/v2/job_templates/%d/", jobTemplateID))
+	}
+	return id, nil
+}
+
+// UpdateProject starts a project update, which the fake keeps with its jobs.
+// It follows the next entry of ProjectUpdates, or Script once those run out.
+func (c *Controller) UpdateProject(_ context.Context, projectID int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("UpdateProject"); err != nil {
+		return 0, err
+	}
+	project, ok := c.ProjectSources[projectID]
+	if !ok {
+		return 0, notFound("POST", fmt.Sprintf("/api/controller/v2/projects/%d/update/", projectID))
+	}
+
+	job := &Job{ID: c.id(), ProjectID: projectID, ScmRevision: project.ScmRevision}
+	script := c.Script
+	if len(c.ProjectUpdates) > 0 {
+		script, c.ProjectUpdates = c.ProjectUpdates[0], c.ProjectUpdates[1:]
+	}
+	script.apply(job)
+	if script.ScmRevision != "" {
+		job.ScmRevision = script.ScmRevision
+	}
+	c.Jobs[job.ID] = job
+	return job.ID, nil
+}
+
+// PollProjectUpdate polls a project update like PollJob.
+func (c *Controller) PollProjectUpdate(ctx context.Context, updateID int, opts client.PollOptions) error {
+	return c.poll(ctx, "PollProjectUpdate", client.KindProjectUpdate, updateID, opts)
+}
+
+func (c *Controller) GetProjectUpdate(_ context.Context, updateID int) (client.ProjectUpdate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetProjectUpdate"); err != nil {
+		return client.ProjectUpdate{}, err
+	}
+	job, ok := c.Jobs[updateID]
+	if !ok || job.ProjectID == 0 {
+		return client.ProjectUpdate{}, notFound("GET", fmt.Sprintf("/api/controller/v2/project_updates/%d/", updateID))
+	}
+	return client.ProjectUpdate{
+		ID:          job.ID,
+		ScmBranch:   c.ProjectSources[job.ProjectID].ScmBranch,
+		ScmRevision: job.ScmRevision,
+	}, nil
+}
+
+func (c *Controller) CreateJobTemplate(_ context.Context, tmpl client.JobTemplate) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("CreateJobTemplate"); err != nil {
+		return 0, err
+	}
+	if _, ok := c.Inventories[tmpl.InventoryID]; !ok {
+		return 0, badRequest("POST", "/api/controller/v2/job_templates/", "inventory", tmpl.InventoryID)
+	}
+	jt := &JobTemplate{ID: c.id(), Name: "packer-jt-" + c.marker, Template: tmpl}
+	c.JobTemplates[jt.ID] = jt
+	return jt.ID, nil
+}
+
+func (c *Controller) AddJobTemplateInstanceGroup(_ context.Context, jobTemplateID, instanceGroupID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("AddJobTemplateInstanceGroup"); err != nil {
+		return err
+	}
+	jt, ok := c.JobTemplates[jobTemplateID]
+	if !ok {
+		return notFound("POST", fmt.Sprintf("/api/controller/v2/job_templates/%d/instance_groups/", jobTemplateID))
+	}
+	jt.InstanceGroupIDs = append(jt.InstanceGroupIDs, instanceGroupID)
+	return nil
+}
+
+func (c *Controller) DeleteJobTemplate(_ context.Context, jobTemplateID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("DeleteJobTemplate"); err != nil {
+		return err
+	}
+	if _, ok := c.JobTemplates[jobTemplateID]; !ok {
+		return notFound("DELETE", fmt.Sprintf("/api/controller/v2/job_templates/%d/", jobTemplateID))
+	}
+	delete(c.JobTemplates, jobTemplateID)
+	return nil
+}
+
+func (c *Controller) LaunchJob(
+	_ context.Context,
+	invID, jobTemplateID, workflowTemplateID int,
+	credentialIDs []int,
+	extraVars map[string]interface{},
+) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("LaunchJob"); err != nil {
+		return 0, err
+	}
+	if _, ok := c.Inventories[invID]; !ok {
+		return 0, badRequest("POST", "/api/controller/v2/job_templates/launch/", "inventory", invID)
+	}
+	for _, id := range credentialIDs {
+		if _, ok := c.Credentials[id]; !ok {
+			return 0, badRequest("POST", "/api/controller/v2/job_templates/launch/", "credentials", id)
+		}
+	}
+
+	job := &Job{
+		ID:                 c.id(),
+		InventoryID:        invID,
+		JobTemplateID:      jobTemplateID,
+		WorkflowTemplateID: workflowTemplateID,
+		CredentialIDs:      credentialIDs,
+		ExtraVars:          extraVars,
+	}
+	c.Script.apply(job)
+	c.Jobs[job.ID] = job
+	return job.ID, nil
+}
+
+// RelaunchJob starts a copy of a finished job. The copy follows the next
+// entry of Relaunches, or Script once those run out.
+func (c *Controller) RelaunchJob(_ context.Context, jobID int, hosts string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("RelaunchJob"); err != nil {
+		return 0, err
+	}
+	original, ok := c.Jobs[jobID]
+	if !ok || original.WorkflowTemplateID != 0 {
+		return 0, notFound("POST", fmt.Sprintf("/api/controller/v2/jobs/%d/relaunch/", jobID))
+	}
+
+	job := &Job{
+		ID:            c.id(),
+		InventoryID:   original.InventoryID,
+		JobTemplateID: original.JobTemplateID,
+		CredentialIDs: original.CredentialIDs,
+		ExtraVars:     original.ExtraVars,
+		RelaunchOf:    jobID,
+		RelaunchHosts: hosts,
+	}
+	script := c.Script
+	if len(c.Relaunches) > 0 {
+		script, c.Relaunches = c.Relaunches[0], c.Relaunches[1:]
+	}
+	script.apply(job)
+	c.Jobs[job.ID] = job
+	return job.ID, nil
+}
+
+// LaunchAdHocCommand starts an ad hoc command, which the fake keeps with
+// its jobs. It follows the next entry of AdHocScripts, or Script once those
+// run out.
+func (c *Controller) LaunchAdHocCommand(_ context.Context, cmd client.AdHocCommand) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("LaunchAdHocCommand"); err != nil {
+		return 0, err
+	}
+	if _, ok := c.Inventories[cmd.InventoryID]; !ok {
+		return 0, badRequest("POST", "/api/controller/v2/ad_hoc_commands/", "inventory", cmd.InventoryID)
+	}
+	if _, ok := c.Credentials[cmd.CredentialID]; cmd.CredentialID != 0 && !ok {
+		return 0, badRequest("POST", "/api/controller/v2/ad_hoc_commands/", "credential", cmd.CredentialID)
+	}
+
+	job := &Job{ID: c.id(), InventoryID: cmd.InventoryID, AdHoc: &cmd}
+	script := c.Script
+	if len(c.AdHocScripts) > 0 {
+		script, c.AdHocScripts = c.AdHocScripts[0], c.AdHocScripts[1:]
+	}
+	script.apply(job)
+	c.Jobs[job.ID] = job
+	return job.ID, nil
+}
+
+// PollAdHocCommand polls an ad hoc command like PollJob.
+func (c *Controller) PollAdHocCommand(ctx context.Context, commandID int, opts client.PollOptions) error {
+	return c.poll(ctx, "PollAdHocCommand", client.KindAdHocCommand, commandID, opts)
+}
+
+// PollJob advances the job by one state per poll interval until it reaches a
+// final state, mirroring AAPClient.PollJob. Each poll streams one event to
+// opts.OnEvent; the remaining events are streamed once the job finishes.
+func (c *Controller) PollJob(ctx context.Context, jobID int, opts client.PollOptions) error {
+	return c.poll(ctx, "PollJob", client.KindJob, jobID, opts)
+}
+
+// PollWorkflowJob polls a workflow job like PollJob. The fake streams the
+// workflow's events as if it ran a single job with the workflow job's ID.
+func (c *Controller) PollWorkflowJob(ctx context.Context, workflowJobID int, opts client.PollOptions) error {
+	started := false
+	onEvent := opts.OnEvent
+	if onEvent != nil && opts.OnJob != nil {
+		opts.OnEvent = func(e client.JobEvent) {
+			if !started {
+				started = true
+				opts.OnJob(workflowJobID, "workflow node")
+			}
+			onEvent(e)
+		}
+	}
+	return c.poll(ctx, "PollWorkflowJob", client.KindWorkflowJob, workflowJobID, opts)
+}
+
+func (c *Controller) poll(ctx context.Context, op string, kind client.JobKind, jobID int, opts client.PollOptions) error {
+	clock := jobclock.New(jobclock.Limits{Overall: opts.Timeout, Queue: opts.QueueTimeout, Run: opts.RunTimeout})
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.PollInterval):
+		}
+
+		status, queue, events, err := c.advance(op, jobID)
+		if err != nil {
+			return err
+		}
+		clock.Observe(status.Status)
+		if opts.OnEvent != nil {
+			for _, e := range events {
+				opts.OnEvent(e)
+			}
+		}
+		status.Kind = kind
+		if status.Outcome() != "" {
+			return status.Err()
+		}
+		if jobclock.Queued(status.Status) && opts.OnQueue != nil {
+			opts.OnQueue(queue)
+		}
+		if e, expired := clock.Expired(); expired {
+			return &client.JobTimeoutError{
+				JobID:   jobID,
+				Started: e.Started,
+				Status:  e.Status,
+				Limit:   e.Limit,
+				Overall: e.Overall,
+				Kind:    kind,
+			}
+		}
+	}
+}
+
+// advance moves the job to its next state and returns it together with its
+// place in the queue and the events that became visible.
+func (c *Controller) advance(op string, jobID int) (client.JobStatus, client.QueueInfo, []client.JobEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(op); err != nil {
+		return client.JobStatus{}, client.QueueInfo{}, nil, err
+	}
+	job, ok := c.Jobs[jobID]
+	if !ok {
+		return client.JobStatus{}, client.QueueInfo{}, nil, notFound("GET", fmt.Sprintf("/api/controller/v2/jobs/%d/", jobID))
+	}
+	if len(job.States) > 0 {
+		job.Status = job.States[0]
+		if len(job.States) > 1 {
+			job.States = job.States[1:]
+		}
+	}
+
+	status := client.JobStatus{
+		ID:               job.ID,
+		Status:           job.Status,
+		Explanation:      job.Explanation,
+		HostStatusCounts: make(map[string]int),
+	}
+	for _, summary := range job.HostSummaries {
+		switch {
+		case summary.Failures > 0:
+			status.HostStatusCounts["failures"]++
+		case summary.Unreachable > 0:
+			status.HostStatusCounts["dark"]++
+		default:
+			status.HostStatusCounts["ok"]++
+		}
+	}
+
+	visible := job.streamed + 1
+	if status.Outcome() != "" {
+		visible = len(job.Events)
+	}
+	var events []client.JobEvent
+	for ; job.streamed < visible && job.streamed < len(job.Events); job.streamed++ {
+		events = append(events, job.Events[job.streamed].client(job.streamed+1))
+	}
+	queue := client.QueueInfo{Status: job.Status, Position: job.QueuePosition, InstanceGroup: job.InstanceGroup}
+	return status, queue, events, nil
+}
+
+func (c *Controller) GetJobStdout(_ context.Context, jobID int) (string, error) {
+	return c.stdout("GetJobStdout", jobID)
+}
+
+func (c *Controller) GetAdHocCommandStdout(_ context.Context, commandID int) (string, error) {
+	return c.stdout("GetAdHocCommandStdout", commandID)
+}
+
+func (c *Controller) GetProjectUpdateStdout(_ context.Context, updateID int) (string, error) {
+	return c.stdout("GetProjectUpdateStdout", updateID)
+}
+
+func (c *Controller) stdout(op string, jobID int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(op); err != nil {
+		return "", err
+	}
+	job, ok := c.Jobs[jobID]
+	if !ok {
+		return "", notFound("GET", fmt.Sprintf("/api/controller/v2/jobs/%d/stdout/", jobID))
+	}
+	if job.Stdout != "" {
+		return job.Stdout, nil
+	}
+	var lines []string
+	for _, e := range job.Events {
+		if e.Stdout != "" {
+			lines = append(lines, e.Stdout)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (c *Controller) GetJobHostSummaries(_ context.Context, jobID int) ([]client.HostSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetJobHostSummaries"); err != nil {
+		return nil, err
+	}
+	job, ok := c.Jobs[jobID]
+	if !ok {
+		return nil, notFound("GET", fmt.Sprintf("/api/controller/v2/jobs/%d/job_host_summaries/", jobID))
+	}
+	return append([]client.HostSummary(nil), job.HostSummaries...), nil
+}
+
+// GetFailedJobEvents returns the job's runner_on_failed and
+// runner_on_unreachable events.
+func (c *Controller) GetFailedJobEvents(_ context.Context, jobID int) ([]client.JobEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call("GetFailedJobEvents"); err != nil {
+		return nil, err
+	}
+	job, ok := c.Jobs[jobID]
+	if !ok {
+		return nil, notFound("GET", fmt.Sprintf("/api/controller/v2/jobs/%d/job_events/", jobID))
+	}
+	var events []client.JobEvent
+	for i, e := range job.Events {
+		if e.Event == "runner_on_failed" || e.Event == "runner_on_unreachable" {
+			events = append(events, e.client(i+1))
+		}
+	}
+	return events, nil
+}
+
+// Leftovers returns a description of every inventory, host, temporary
+// credential, custom credential type and job template that still exists. Tests use it to assert that cleanup removed everything.
+func (c *Controller) Leftovers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var left []string
+	for id := range c.Inventories {
+		left = append(left, fmt.Sprintf("inventory %d", id))
+	}
+	for id := range c.Hosts {
+		left = append(left, fmt.Sprintf("host %d", id))
+	}
+	for id := range c.Groups {
+		left = append(left, fmt.Sprintf("group %d", id))
+	}
+	for id, cred := range c.Credentials {
+		if cred.temporary {
+			left = append(left, fmt.Sprintf("credential %d", id))
+		}
+	}
+	for id := range c.CreatedCredentialTypes {
+		left = append(left, fmt.Sprintf("credential type %d", id))
+	}
+	for id := range c.JobTemplates {
+		left = append(left, fmt.Sprintf("job template %d", id))
+	}
+	sort.Strings(left)
+	return left
+}
+
+func notFound(method, path string) error {
+	return &client.APIError{Method: method, Path: path, StatusCode: 404, Detail: "Not found."}
+}
+
+func badRequest(method, path, field string, id int) error {
+	return &client.APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: 400,
+		FieldErrors: map[string][]string{
+			field: {fmt.Sprintf("Invalid pk \"%d\" - object does not exist.", id)},
+		},
+	}
+}
@@ -0,0 +1,149 @@
+package aaptest_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/aaptest"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
+)
+
+func newTestClient(url string) *client.AAPClient {
+	return client.NewAAPClient(config.Config{
+		TowerHost:          url,
+		AccessToken:        "token",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+}
+
+// The fake must time jobs out exactly like the client, since scenario tests
+// rely on it to cover queue_timeout, run_timeout and timeout.
+func TestController_PollJob_TimesOutLikeClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		opts    client.PollOptions
+		wantErr error
+	}{
+		{
+			name:    "stuck in queue",
+			status:  "pending",
+			opts:    client.PollOptions{QueueTimeout: 50 * time.Millisecond, RunTimeout: time.Hour},
+			wantErr: client.ErrJobQueueTimeout,
+		},
+		{
+			name:    "runs too long",
+			status:  "running",
+			opts:    client.PollOptions{QueueTimeout: time.Hour, RunTimeout: 50 * time.Millisecond},
+			wantErr: client.ErrJobRunTimeout,
+		},
+		{
+			name:    "overall timeout while queued",
+			status:  "waiting",
+			opts:    client.PollOptions{Timeout: 50 * time.Millisecond, QueueTimeout: time.Hour},
+			wantErr: client.ErrJobQueueTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := aaptest.NewController()
+			fake.Script = aaptest.JobScript{States: []string{tt.status}}
+			invID, err := fake.CreateInventory(t.Context(), 1)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			jobID, err := fake.LaunchJob(t.Context(), invID, 42, 0, nil, nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != fmt.Sprintf("/api/controller/v2/jobs/%d/", jobID) {
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(`{"count": 0, "next": null, "results": []}`))
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"id": %d, "status": %q}`, jobID, tt.status)
+			}))
+			defer server.Close()
+
+			opts := tt.opts
+			opts.PollInterval = 10 * time.Millisecond
+			want := newTestClient(server.URL).PollJob(t.Context(), jobID, opts)
+			got := fake.PollJob(t.Context(), jobID, opts)
+
+			if !errors.Is(want, tt.wantErr) {
+				t.Fatalf("Expected the client to return %v, got %v", tt.wantErr, want)
+			}
+			if !errors.Is(got, tt.wantErr) || !errors.Is(got, client.ErrJobTimeout) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, got)
+			}
+			if got.Error() != want.Error() {
+				t.Errorf("Expected %q, got %q", want.Error(), got.Error())
+			}
+		})
+	}
+}
+
+// The fake must resolve credential types by name and kind like the client.
+func TestController_LookupCredentialType_MatchesClient(t *testing.T) {
+	types := []map[string]interface{}{
+		{"id": 1, "name": "Machine", "kind": "ssh"},
+		{"id": 3, "name": "Vault", "kind": "vault"},
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/controller/v2/credential_types/" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		results := []map[string]interface{}{}
+		for _, ct := range types {
+			if ct["name"] == query.Get("name") && (query.Get("kind") == "" || ct["kind"] == query.Get("kind")) {
+				results = append(results, ct)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		kind string
+	}{
+		{name: "Machine", kind: "ssh"},
+		{name: "Machine"},
+		{name: "Vault", kind: "vault"},
+		{name: "Vault", kind: "ssh"},
+		{name: "Amazon Web Services", kind: "cloud"},
+		{name: "Amazon Web Services"},
+	}
+
+	aap := newTestClient(server.URL)
+	fake := aaptest.NewController()
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.kind, func(t *testing.T) {
+			wantID, wantErr := aap.LookupCredentialType(t.Context(), tt.name, tt.kind)
+			gotID, gotErr := fake.LookupCredentialType(t.Context(), tt.name, tt.kind)
+
+			if gotID != wantID {
+				t.Errorf("Expected ID %d, got %d", wantID, gotID)
+			}
+			if (gotErr == nil) != (wantErr == nil) {
+				t.Fatalf("Expected error %v, got %v", wantErr, gotErr)
+			}
+			if wantErr != nil && gotErr.Error() != wantErr.Error() {
+				t.Errorf("Expected %q, got %q", wantErr.Error(), gotErr.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// AdHocCommand is a single module run against an inventory.
+type AdHocCommand struct {
+	InventoryID int
+	// CredentialID is the machine credential used to reach the hosts.
+	CredentialID int
+	ModuleName   string
+	ModuleArgs   string
+	// Limit restricts the command to hosts matching the pattern.
+	Limit     string
+	Become    bool
+	Verbosity int
+	ExtraVars map[string]interface{}
+}
+
+// LaunchAdHocCommand starts an ad hoc command and returns its ID.
+func (c *AAPClient) LaunchAdHocCommand(ctx context.Context, cmd AdHocCommand) (int, error) {
+	body := map[string]interface{}{
+		"inventory":      cmd.InventoryID,
+		"module_name":    cmd.ModuleName,
+		"module_args":    cmd.ModuleArgs,
+		"limit":          cmd.Limit,
+		"become_enabled": cmd.Become,
+		"verbosity":      cmd.Verbosity,
+	}
+	if cmd.CredentialID != 0 {
+		body["credential"] = cmd.CredentialID
+	}
+	if len(cmd.ExtraVars) > 0 {
+		extraVars, err := json.Marshal(cmd.ExtraVars)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal extra vars: %w", err)
+		}
+		body["extra_vars"] = string(extraVars)
+	}
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(body).
+		Post("/api/controller/v2/ad_hoc_commands/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to launch ad hoc command: %w", err)
+	}
+	if resp.IsError() {
+		return 0, fmt.Errorf("failed to launch ad hoc command: %w", newAPIError(resp))
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse ad hoc command response: %w", err)
+	}
+	if result.ID == 0 {
+		return 0, errors.New("ad hoc command response did not include an ID")
+	}
+	return result.ID, nil
+}
+
+// PollAdHocCommand waits for an ad hoc command to finish like PollJob,
+// including its events and websocket support.
+func (c *AAPClient) PollAdHocCommand(ctx context.Context, commandID int, opts PollOptions) error {
+	return c.poll(ctx, KindAdHocCommand, commandID, opts)
+}
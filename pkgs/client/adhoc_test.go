@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+func TestAAPClient_AdHocCommand(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/controller/v2/ad_hoc_commands/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST, got %s", r.Method)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		want := map[string]interface{}{
+			"inventory":      float64(123),
+			"credential":     float64(456),
+			"module_name":    "ansible.builtin.ping",
+			"module_args":    "",
+			"limit":          "web1",
+			"become_enabled": false,
+			"verbosity":      float64(0),
+		}
+		if !reflect.DeepEqual(body, want) {
+			t.Errorf("Expected body %v, got %v", want, body)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 7, "type": "ad_hoc_command"}`))
+	})
+	mux.HandleFunc("/api/controller/v2/ad_hoc_commands/7/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 7, "status": "successful"}`))
+	})
+	mux.HandleFunc("/api/controller/v2/ad_hoc_commands/7/events/", func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w, r, []int{1, 2})
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	c := newJobsTestClient(server.URL)
+	commandID, err := c.LaunchAdHocCommand(t.Context(), client.AdHocCommand{
+		InventoryID:  123,
+		CredentialID: 456,
+		ModuleName:   "ansible.builtin.ping",
+		Limit:        "web1",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if commandID != 7 {
+		t.Fatalf("Expected ad hoc command ID 7, got %d", commandID)
+	}
+
+	var got []int
+	err = c.PollAdHocCommand(t.Context(), commandID, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+		OnEvent: func(e client.JobEvent) {
+			got = append(got, e.Counter)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import "context"
+
+// API is the set of controller operations the provisioner relies on.
+// AAPClient talks to a real controller; the aaptest package provides an
+// in-memory fake for tests.
+type API interface {
+	// RunMarker returns the token embedded in the names of all created resources.
+	RunMarker() string
+
+	CreateInventory(ctx context.Context, orgID int) (int, error)
+	DeleteInventory(ctx context.Context, invID int) error
+	UpdateInventoryVariables(ctx context.Context, invID int, vars map[string]interface{}) error
+
+	CreateHost(ctx context.Context, invID int, details HostDetails) (int, error)
+	DeleteHost(ctx context.Context, hostID int) error
+
+	CreateGroup(ctx context.Context, invID int, name string, vars map[string]interface{}) (int, error)
+	AddHostToGroup(ctx context.Context, groupID, hostID int) error
+	DeleteGroup(ctx context.Context, groupID int) error
+
+	GetCredentialTypeID(ctx context.Context, name string) (int, error)
+	LookupCredentialType(ctx context.Context, name, kind string) (int, error)
+	CreateMachineCredential(ctx context.Context, orgID int, cred MachineCredential) (int, error)
+	CreateVaultCredential(ctx context.Context, orgID int, vaultPassword, vaultID string) (int, error)
+	CreateCustomCredential(ctx context.Context, orgID, credentialTypeID int, inputs map[string]interface{}) (int, error)
+	CreateCredentialType(ctx context.Context, def CredentialTypeDefinition) (int, error)
+	DeleteCredentialType(ctx context.Context, credentialTypeID int) error
+	DeleteCredential(ctx context.Context, credentialID int) error
+	GetCredential(ctx context.Context, credentialID int) (Credential, error)
+	FindCredential(ctx context.Context, name string) (Credential, error)
+	GetTemplateCredentials(ctx context.Context, jobTemplateID int) ([]Credential, error)
+
+	FindProject(ctx context.Context, name string) (int, error)
+	GetProject(ctx context.Context, projectID int) (Project, error)
+	GetJobTemplateProject(ctx context.Context, jobTemplateID int) (int, error)
+	UpdateProject(ctx context.Context, projectID int) (int, error)
+	PollProjectUpdate(ctx context.Context, updateID int, opts PollOptions) error
+	GetProjectUpdate(ctx context.Context, updateID int) (ProjectUpdate, error)
+	GetProjectUpdateStdout(ctx context.Context, updateID int) (string, error)
+	CreateJobTemplate(ctx context.Context, tmpl JobTemplate) (int, error)
+	AddJobTemplateInstanceGroup(ctx context.Context, jobTemplateID, instanceGroupID int) error
+	DeleteJobTemplate(ctx context.Context, jobTemplateID int) error
+
+	LaunchJob(ctx context.Context, invID, jobTemplateID, workflowTemplateID int, credentialIDs []int, extraVars map[string]interface{}) (int, error)
+	RelaunchJob(ctx context.Context, jobID int, hosts string) (int, error)
+	PollJob(ctx context.Context, jobID int, opts PollOptions) error
+	PollWorkflowJob(ctx context.Context, workflowJobID int, opts PollOptions) error
+	GetJobStdout(ctx context.Context, jobID int) (string, error)
+	GetJobHostSummaries(ctx context.Context, jobID int) ([]HostSummary, error)
+	GetFailedJobEvents(ctx context.Context, jobID int) ([]JobEvent, error)
+
+	LaunchAdHocCommand(ctx context.Context, cmd AdHocCommand) (int, error)
+	PollAdHocCommand(ctx context.Context, commandID int, opts PollOptions) error
+	GetAdHocCommandStdout(ctx context.Context, commandID int) (string, error)
+}
+
+var _ API = (*AAPClient)(nil)
@@ -2,26 +2,94 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	resty "github.com/go-resty/resty/v2"
 	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
 )
 
+// ErrCredentialTypeNotFound is returned when a credential type lookup has no match.
+var ErrCredentialTypeNotFound = errors.New("credential type not found")
+
+// maxCreateAttempts bounds how often a create request is retried after an
+// ambiguous failure.
+const maxCreateAttempts = 3
+
 type AAPClient struct {
 	client *resty.Client
+	// marker uniquely identifies this client's run. It is embedded in the name
+	// and description of every resource we create so that resources can be
+	// found again when a create request fails ambiguously.
+	marker string
+
+	// credentialTypes caches credential type IDs by kind and name for the
+	// lifetime of the client.
+	credentialTypesMu sync.Mutex
+	credentialTypes   map[string]int
+
+	// authorization and tlsConfig are reused for websocket connections.
+	authorization string
+	tlsConfig     *tls.Config
+	// username and password start the session the websocket needs. They
+	// are empty with token authentication.
+	username string
+	password string
+	// session holds the websocket's login session in its own cookie jar.
+	// Session cookies must not reach REST requests: the controller checks
+	// the session before Basic authentication and then requires a CSRF
+	// token on every POST and DELETE.
+	session *resty.Client
 }
 
 type HostDetails struct {
+	// Name is the inventory hostname. Defaults to Host.
+	Name     string
 	Host     string
 	Port     int
 	Username string
 	Password string
+	// Connection is the Ansible connection plugin, "ssh" or "winrm".
+	// Defaults to "ssh".
+	Connection string
+	// ShellType is set to "powershell" or "cmd" for Windows hosts reached
+	// over SSH.
+	ShellType string
+	// WinRM configures WinRM connections. Zero fields keep the defaults.
+	WinRM WinRMOptions
+	// BecomeMethod and BecomeUser configure privilege escalation on Windows
+	// hosts. They default to "runas" and "Administrator".
+	BecomeMethod string
+	BecomeUser   string
+	// Vars are merged over the computed connection variables.
+	Vars map[string]interface{}
+}
+
+// WinRMOptions are the connection settings of a WinRM host.
+type WinRMOptions struct {
+	// Scheme is "http" or "https". Defaults to https on port 5986 and http
+	// on port 5985.
+	Scheme string
+	// Transport is the authentication transport. Defaults to "basic".
+	Transport string
+	// ServerCertValidation is "validate" or "ignore". Defaults to "ignore".
+	ServerCertValidation string
+	// CATrustPath is the CA bundle used to validate the server certificate,
+	// as a path on the execution node.
+	CATrustPath       string
+	MessageEncryption string
+	OperationTimeout  time.Duration
+	ReadTimeout       time.Duration
 }
 
 func NewAAPClient(cfg config.Config) *AAPClient {
@@ -30,119 +98,282 @@ func NewAAPClient(cfg config.Config) *AAPClient {
 		SetHeader("Content-Type", "application/json").
 		SetTimeout(cfg.Timeout)
 
+	var tlsConfig *tls.Config
 	if cfg.InsecureSkipVerify {
-		client.SetTLSClientConfig(&tls.Config{
+		tlsConfig = &tls.Config{
 			InsecureSkipVerify: true,
-		})
+		}
+		client.SetTLSClientConfig(tlsConfig)
 	}
 
-	if cfg.AccessToken != "" {
+	session := resty.New().
+		SetBaseURL(cfg.TowerHost).
+		SetTimeout(cfg.Timeout)
+	if tlsConfig != nil {
+		session.SetTLSClientConfig(tlsConfig)
+	}
 
-		client.SetHeader("Authorization", fmt.Sprintf("Bearer %s", cfg.AccessToken))
+	c := &AAPClient{
+		client:          client,
+		marker:          newRunMarker(),
+		credentialTypes: make(map[string]int),
+		tlsConfig:       tlsConfig,
+		session:         session,
+	}
+	if cfg.AccessToken != "" {
+		c.authorization = fmt.Sprintf("Bearer %s", cfg.AccessToken)
 	} else {
+		c.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.Username+":"+cfg.Password))
+		c.username = cfg.Username
+		c.password = cfg.Password
+	}
+	client.SetHeader("Authorization", c.authorization)
+	return c
+}
 
-		client.SetBasicAuth(cfg.Username, cfg.Password)
+// newRunMarker returns a short random token identifying a single provisioning run.
+func newRunMarker() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
 	}
+	return hex.EncodeToString(b)
+}
 
-	return &AAPClient{client: client}
+// RunMarker returns the token embedded in the names of all resources created by this client.
+func (c *AAPClient) RunMarker() string {
+	return c.marker
 }
 
-func (c *AAPClient) CreateInventory(ctx context.Context, orgID int) (int, error) {
-	invBody := map[string]interface{}{
-		"name":         fmt.Sprintf("packer-inv-%d", time.Now().Unix()),
-		"description":  "Temporary inventory for packer provisioning",
-		"organization": orgID,
-	}
+// resourceName builds the name of a temporary resource from a prefix and the run marker.
+func (c *AAPClient) resourceName(prefix string) string {
+	return fmt.Sprintf("%s-%s", prefix, c.marker)
+}
 
-	resp, err := c.client.R().
-		SetContext(ctx).
-		SetBody(invBody).
-		Post("/api/controller/v2/inventories/")
+// description appends the run marker token to a resource description.
+func (c *AAPClient) description(text string) string {
+	return fmt.Sprintf("%s [packer-run:%s]", text, c.marker)
+}
 
-	if err != nil {
-		return 0, fmt.Errorf("failed to create inventory: %s", err)
+// createResource POSTs body to path and returns the ID of the created object.
+// If the request fails ambiguously (transport error or 5xx response) the server
+// may still have committed it, so the object is looked up with the lookup query
+// before the request is retried, and once more after the last attempt. This
+// keeps us from creating duplicate or untracked resources.
+func (c *AAPClient) createResource(ctx context.Context, kind, path string, body map[string]interface{}, lookup url.Values) (int, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxCreateAttempts; attempt++ {
+		resp, err := c.client.R().
+			SetContext(ctx).
+			SetBody(body).
+			Post(path)
+
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return 0, fmt.Errorf("failed to create %s: %w", kind, err)
+		case err != nil:
+			lastErr = err
+		case resp.StatusCode() >= 500:
+			lastErr = newAPIError(resp)
+		default:
+			return createdID(kind, resp)
+		}
+
+		id, err := c.findResource(ctx, path, lookup)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create %s: %w (lookup after ambiguous failure: %s)", kind, lastErr, err)
+		}
+		if id != 0 {
+			return id, nil
+		}
 	}
 
+	return 0, fmt.Errorf("failed to create %s after %d attempts: %w", kind, maxCreateAttempts, lastErr)
+}
+
+// createdID returns the ID of the object a create request returned.
+func createdID(kind string, resp *resty.Response) (int, error) {
 	if resp.IsError() {
-		return 0, fmt.Errorf("failed to create inventory: %s (status: %d)", resp.String(), resp.StatusCode())
+		return 0, fmt.Errorf("failed to create %s: %w", kind, newAPIError(resp))
 	}
 
 	var result struct {
 		ID int `json:"id"`
 	}
 	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return 0, fmt.Errorf("failed to parse inventory response: %s", err)
+		return 0, fmt.Errorf("failed to parse %s response: %w", kind, err)
 	}
-
 	if result.ID == 0 {
-		return 0, fmt.Errorf("failed to create inventory. Response: %s", resp.String())
+		return 0, fmt.Errorf("failed to create %s. Response: %s", kind, resp.String())
 	}
-
 	return result.ID, nil
 }
 
-func (c *AAPClient) CreateHost(ctx context.Context, invID int, details HostDetails, credentialType string) (int, error) {
+// findResource returns the ID of the single object at path matching query, or 0 if there is none.
+func (c *AAPClient) findResource(ctx context.Context, path string, query url.Values) (int, error) {
+	var result struct {
+		Count   int `json:"count"`
+		Results []struct {
+			ID int `json:"id"`
+		} `json:"results"`
+	}
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetQueryParamsFromValues(query).
+		Get(path)
+
+	if err != nil {
+		return 0, err
+	}
+	if resp.IsError() {
+		return 0, newAPIError(resp)
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse lookup response: %w", err)
+	}
+
+	switch len(result.Results) {
+	case 0:
+		return 0, nil
+	case 1:
+		return result.Results[0].ID, nil
+	default:
+		return 0, fmt.Errorf("%d objects match %s", len(result.Results), query.Encode())
+	}
+}
+
+func (c *AAPClient) CreateInventory(ctx context.Context, orgID int) (int, error) {
+	name := c.resourceName("packer-inv")
+	invBody := map[string]interface{}{
+		"name":         name,
+		"description":  c.description("Temporary inventory for packer provisioning"),
+		"organization": orgID,
+	}
+
+	return c.createResource(ctx, "inventory", "/api/controller/v2/inventories/", invBody, url.Values{
+		"name":         {name},
+		"organization": {fmt.Sprint(orgID)},
+	})
+}
+
+// HostVars returns the variables set on a host: the connection variables
+// derived from the host details, with details.Vars merged over them.
+func HostVars(details HostDetails) map[string]interface{} {
 	hostVars := map[string]interface{}{
 		"ansible_host": details.Host,
-		"ansible_port": details.Port,
-		"ansible_user": details.Username,
+	}
+	if details.Port != 0 {
+		hostVars["ansible_port"] = details.Port
+	}
+	if details.Username != "" {
+		hostVars["ansible_user"] = details.Username
+	}
+	if details.Password != "" {
+		hostVars["ansible_password"] = details.Password
 	}
 
-	// Set connection type based on port or credential type
-	if details.Port == 5985 || details.Port == 5986 || credentialType == "winrm_password" {
+	if details.Connection == "winrm" {
 		// Windows host - use WinRM
+		winrm := details.WinRM
 		hostVars["ansible_connection"] = "winrm"
-		hostVars["ansible_winrm_server_cert_validation"] = "ignore"
-		hostVars["ansible_winrm_transport"] = "basic"
-		hostVars["ansible_become_method"] = "runas"
+		hostVars["ansible_winrm_server_cert_validation"] = valueOr(winrm.ServerCertValidation, "ignore")
+		hostVars["ansible_winrm_transport"] = valueOr(winrm.Transport, "basic")
+		hostVars["ansible_become_method"] = valueOr(details.BecomeMethod, "runas")
 		hostVars["ansible_become"] = "yes"
-		hostVars["ansible_become_user"] = "Administrator"
+		hostVars["ansible_become_user"] = valueOr(details.BecomeUser, "Administrator")
 
-		switch details.Port {
-		case 5985:
+		switch {
+		case winrm.Scheme != "":
+			hostVars["ansible_winrm_scheme"] = winrm.Scheme
+		case details.Port == 5985:
 			hostVars["ansible_winrm_scheme"] = "http"
-		case 5986:
+		case details.Port == 5986:
 			hostVars["ansible_winrm_scheme"] = "https"
 		}
 
+		if winrm.CATrustPath != "" {
+			hostVars["ansible_winrm_ca_trust_path"] = winrm.CATrustPath
+		}
+		if winrm.MessageEncryption != "" {
+			hostVars["ansible_winrm_message_encryption"] = winrm.MessageEncryption
+		}
+		if winrm.OperationTimeout > 0 {
+			hostVars["ansible_winrm_operation_timeout_sec"] = int(winrm.OperationTimeout.Seconds())
+		}
+		if winrm.ReadTimeout > 0 {
+			hostVars["ansible_winrm_read_timeout_sec"] = int(winrm.ReadTimeout.Seconds())
+		}
+
 	} else {
 		// Linux host - use SSH
 		hostVars["ansible_connection"] = "ssh"
+
+		// Windows host with OpenSSH
+		if details.ShellType != "" {
+			hostVars["ansible_shell_type"] = details.ShellType
+			hostVars["ansible_become_method"] = valueOr(details.BecomeMethod, "runas")
+			hostVars["ansible_become_user"] = valueOr(details.BecomeUser, "Administrator")
+		}
 	}
 
 	// Note: We don't set ansible_ssh_private_key_file here because we're using AAP credentials
 	// The credential will handle the SSH authentication
 
-	hostVarsJSON, err := json.Marshal(hostVars)
-	if err != nil {
-		return 0, fmt.Errorf("failed to marshal host variables: %s", err)
+	for key, value := range details.Vars {
+		hostVars[key] = value
 	}
+	return hostVars
+}
 
-	hostBody := map[string]interface{}{
-		"name":      details.Host,
-		"inventory": invID,
-		"variables": string(hostVarsJSON),
+// InventoryName returns the host's inventory hostname: Name, or a name
+// derived from Host.
+func (d HostDetails) InventoryName() string {
+	if d.Name != "" {
+		return d.Name
 	}
+	return hostName(d.Host)
+}
 
-	resp, err := c.client.R().
-		SetContext(ctx).
-		SetBody(hostBody).
-		Post("/api/controller/v2/hosts/")
-
-	if err != nil {
-		return 0, fmt.Errorf("failed to create host: %s", err)
+// hostName derives an inventory hostname from an address. IPv6 literals are
+// rewritten with dashes, since colons in hostnames are read as a port
+// separator by Ansible's inventory parsers.
+func hostName(address string) string {
+	ip, _, _ := strings.Cut(address, "%")
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return strings.NewReplacer(":", "-", "%", "-").Replace(address)
 	}
-	if resp.IsError() {
-		return 0, fmt.Errorf("failed to create host: %s (status: %d)", resp.String(), resp.StatusCode())
+	return address
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
 	}
+	return value
+}
 
-	var result struct {
-		ID int `json:"id"`
+func (c *AAPClient) CreateHost(ctx context.Context, invID int, details HostDetails) (int, error) {
+	hostVars := HostVars(details)
+
+	hostVarsJSON, err := json.Marshal(hostVars)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal host variables: %w", err)
 	}
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return 0, fmt.Errorf("failed to parse host response: %s", err)
+
+	name := details.InventoryName()
+
+	hostBody := map[string]interface{}{
+		"name":        name,
+		"description": c.description("Packer build host"),
+		"inventory":   invID,
+		"variables":   string(hostVarsJSON),
 	}
-	return result.ID, nil
+
+	return c.createResource(ctx, "host", "/api/controller/v2/hosts/", hostBody, url.Values{
+		"name":      {name},
+		"inventory": {fmt.Sprint(invID)},
+	})
 }
 
 func (c *AAPClient) DeleteHost(ctx context.Context, hostID int) error {
@@ -151,10 +382,10 @@ func (c *AAPClient) DeleteHost(ctx context.Context, hostID int) error {
 		Delete(fmt.Sprintf("/api/controller/v2/hosts/%d/", hostID))
 
 	if err != nil {
-		return fmt.Errorf("failed to delete host: %s", err)
+		return fmt.Errorf("failed to delete host: %w", err)
 	}
 	if resp.IsError() {
-		return fmt.Errorf("failed to delete host: %s (status: %d)", resp.String(), resp.StatusCode())
+		return fmt.Errorf("failed to delete host: %w", newAPIError(resp))
 	}
 	return nil
 }
@@ -165,238 +396,177 @@ func (c *AAPClient) DeleteInventory(ctx context.Context, invID int) error {
 		Delete(fmt.Sprintf("/api/controller/v2/inventories/%d/", invID))
 
 	if err != nil {
-		return fmt.Errorf("failed to delete inventory: %s", err)
+		return fmt.Errorf("failed to delete inventory: %w", err)
 	}
 	if resp.IsError() {
-		return fmt.Errorf("failed to delete inventory: %s (status: %d)", resp.String(), resp.StatusCode())
+		return fmt.Errorf("failed to delete inventory: %w", newAPIError(resp))
 	}
 	return nil
 }
 
-func (c *AAPClient) GetCredentialTypes(ctx context.Context) ([]struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-}, error) {
-	// Fetch all pages of credential types
-	var allResults []struct {
-		ID   int    `json:"id"`
-		Name string `json:"name"`
-	}
-
-	url := "/api/controller/v2/credential_types/?page_size=200"
-	for url != "" {
-		resp, err := c.client.R().
-			SetContext(ctx).
-			Get(url)
-
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch credential types: %s", err)
-		}
-		if resp.IsError() {
-			return nil, fmt.Errorf("failed to fetch credential types: %s (status: %d)", resp.String(), resp.StatusCode())
-		}
-
-		var result struct {
-			Results []struct {
-				ID   int    `json:"id"`
-				Name string `json:"name"`
-			} `json:"results"`
-			Next *string `json:"next"`
-		}
-		if err := json.Unmarshal(resp.Body(), &result); err != nil {
-			return nil, fmt.Errorf("failed to parse credential types response: %s", err)
-		}
-
-		allResults = append(allResults, result.Results...)
-
-		if result.Next != nil && *result.Next != "" {
-			// Extract just the path from the next URL since it might be a full URL
-			if strings.HasPrefix(*result.Next, "http") {
-				// Parse the URL to get just the path and query
-				parts := strings.SplitN(*result.Next, "/api/", 2)
-				if len(parts) == 2 {
-					url = "/api/" + parts[1]
-				} else {
-					url = ""
-				}
-			} else {
-				url = *result.Next
-			}
-		} else {
-			url = ""
-		}
-	}
-
-	return allResults, nil
-}
-
+// GetCredentialTypeID returns the ID of the credential type with the given name.
 func (c *AAPClient) GetCredentialTypeID(ctx context.Context, name string) (int, error) {
-	credTypes, err := c.GetCredentialTypes(ctx)
-	if err != nil {
-		return 0, err
-	}
+	return c.LookupCredentialType(ctx, name, "")
+}
 
-	for _, ct := range credTypes {
-		if ct.Name == name {
-			return ct.ID, nil
-		}
-	}
+// LookupCredentialType returns the ID of the credential type with the given
+// name and, if kind is not empty, kind (e.g. "ssh", "vault", "cloud"). Results
+// are cached for the lifetime of the client, so each type is only resolved
+// once no matter how many credentials are created.
+func (c *AAPClient) LookupCredentialType(ctx context.Context, name, kind string) (int, error) {
+	key := kind + "/" + name
 
-	// Build available types list for error message
-	var available []string
-	for _, ct := range credTypes {
-		available = append(available, fmt.Sprintf("%s (ID: %d)", ct.Name, ct.ID))
+	c.credentialTypesMu.Lock()
+	defer c.credentialTypesMu.Unlock()
+	if id, ok := c.credentialTypes[key]; ok {
+		return id, nil
 	}
 
-	return 0, fmt.Errorf("credential type '%s' not found. Available types: %s", name, strings.Join(available, ", "))
-}
-
-func (c *AAPClient) CreateCredential(ctx context.Context, orgID int, username, privateKeyData string) (int, error) {
-	credentialTypeID, err := c.GetCredentialTypeID(ctx, "Machine")
-	if err != nil {
-		return 0, fmt.Errorf("failed to get Machine credential type ID: %s", err)
-	}
-
-	credentialBody := map[string]interface{}{
-		"name":            fmt.Sprintf("packer-ssh-cred-%d", time.Now().Unix()),
-		"description":     "SSH credential for Packer builds",
-		"credential_type": credentialTypeID,
-		"organization":    orgID,
-		"inputs": map[string]interface{}{
-			"username":     username,
-			"ssh_key_data": privateKeyData,
-		},
+	query := url.Values{"name": {name}}
+	if kind != "" {
+		query.Set("kind", kind)
 	}
 
 	resp, err := c.client.R().
 		SetContext(ctx).
-		SetBody(credentialBody).
-		Post("/api/controller/v2/credentials/")
+		SetQueryParamsFromValues(query).
+		Get("/api/controller/v2/credential_types/")
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to create credential: %s", err)
+		return 0, fmt.Errorf("failed to fetch credential types: %w", err)
 	}
 	if resp.IsError() {
-		return 0, fmt.Errorf("failed to create credential: %s (status: %d)", resp.String(), resp.StatusCode())
+		return 0, fmt.Errorf("failed to fetch credential types: %w", newAPIError(resp))
 	}
 
 	var result struct {
-		ID int `json:"id"`
+		Results []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+			Kind string `json:"kind"`
+		} `json:"results"`
 	}
 	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return 0, fmt.Errorf("failed to parse credential response: %s", err)
+		return 0, fmt.Errorf("failed to parse credential types response: %w", err)
 	}
 
-	if result.ID == 0 {
-		return 0, fmt.Errorf("failed to create credential. Response: %s", resp.String())
+	// Filter again locally in case the controller ignored the query filters.
+	for _, ct := range result.Results {
+		if ct.Name == name && (kind == "" || ct.Kind == kind) {
+			c.credentialTypes[key] = ct.ID
+			return ct.ID, nil
+		}
 	}
 
-	return result.ID, nil
+	if kind != "" {
+		return 0, fmt.Errorf("%w: '%s' of kind '%s'", ErrCredentialTypeNotFound, name, kind)
+	}
+	return 0, fmt.Errorf("%w: '%s'", ErrCredentialTypeNotFound, name)
 }
 
-func (c *AAPClient) DeleteCredential(ctx context.Context, credentialID int) error {
-	resp, err := c.client.R().
-		SetContext(ctx).
-		Delete(fmt.Sprintf("/api/controller/v2/credentials/%d/", credentialID))
+// MachineCredential holds the inputs of an AAP "Machine" credential. Empty
+// fields are left out of the request.
+type MachineCredential struct {
+	Username string
+	Password string
+	// SSHKeyData is the private key and SSHKeyUnlock its passphrase, if encrypted.
+	SSHKeyData   string
+	SSHKeyUnlock string
+	// SSHPublicKeyData is a signed SSH certificate used together with SSHKeyData.
+	SSHPublicKeyData string
+	BecomeMethod     string
+	BecomeUsername   string
+	BecomePassword   string
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to delete credential: %s", err)
-	}
-	if resp.IsError() {
-		return fmt.Errorf("failed to delete credential: %s (status: %d)", resp.String(), resp.StatusCode())
+// Inputs returns the credential inputs as sent to the controller.
+func (m MachineCredential) Inputs() map[string]interface{} {
+	inputs := map[string]interface{}{}
+	for key, value := range map[string]string{
+		"username":            m.Username,
+		"password":            m.Password,
+		"ssh_key_data":        m.SSHKeyData,
+		"ssh_key_unlock":      m.SSHKeyUnlock,
+		"ssh_public_key_data": m.SSHPublicKeyData,
+		"become_method":       m.BecomeMethod,
+		"become_username":     m.BecomeUsername,
+		"become_password":     m.BecomePassword,
+	} {
+		if value != "" {
+			inputs[key] = value
+		}
 	}
-	return nil
+	return inputs
 }
 
-func (c *AAPClient) CreatePasswordCredential(ctx context.Context, orgID int, username, password string) (int, error) {
-	credentialTypeID, err := c.GetCredentialTypeID(ctx, "Machine")
+// CreateMachineCredential creates a temporary Machine credential with the given inputs.
+func (c *AAPClient) CreateMachineCredential(ctx context.Context, orgID int, cred MachineCredential) (int, error) {
+	credentialTypeID, err := c.LookupCredentialType(ctx, "Machine", "ssh")
 	if err != nil {
-		return 0, fmt.Errorf("failed to get Machine credential type ID: %s", err)
+		return 0, fmt.Errorf("failed to get Machine credential type ID: %w", err)
 	}
 
+	name := c.resourceName("packer-machine-cred")
 	credentialBody := map[string]interface{}{
-		"name":            fmt.Sprintf("packer-password-cred-%d", time.Now().Unix()),
-		"description":     "SSH password credential for Packer builds",
+		"name":            name,
+		"description":     c.description("Machine credential for Packer builds"),
 		"credential_type": credentialTypeID,
 		"organization":    orgID,
-		"inputs": map[string]interface{}{
-			"username": username,
-			"password": password,
-		},
+		"inputs":          cred.Inputs(),
 	}
 
-	resp, err := c.client.R().
-		SetContext(ctx).
-		SetBody(credentialBody).
-		Post("/api/controller/v2/credentials/")
+	return c.createResource(ctx, "machine credential", "/api/controller/v2/credentials/", credentialBody, url.Values{
+		"name": {name},
+	})
+}
 
+// CreateVaultCredential creates a temporary Vault credential holding an
+// Ansible Vault password and, optionally, its vault ID.
+func (c *AAPClient) CreateVaultCredential(ctx context.Context, orgID int, vaultPassword, vaultID string) (int, error) {
+	credentialTypeID, err := c.LookupCredentialType(ctx, "Vault", "vault")
 	if err != nil {
-		return 0, fmt.Errorf("failed to create password credential: %s", err)
-	}
-	if resp.IsError() {
-		return 0, fmt.Errorf("failed to create password credential: %s (status: %d)", resp.String(), resp.StatusCode())
+		return 0, fmt.Errorf("failed to get Vault credential type ID: %w", err)
 	}
 
-	var result struct {
-		ID int `json:"id"`
-	}
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return 0, fmt.Errorf("failed to parse password credential response: %s", err)
-	}
-
-	if result.ID == 0 {
-		return 0, fmt.Errorf("failed to create password credential. Response: %s", resp.String())
+	inputs := map[string]interface{}{
+		"vault_password": vaultPassword,
 	}
-
-	return result.ID, nil
-}
-
-func (c *AAPClient) CreateWinRMCredential(ctx context.Context, orgID int, username, password string) (int, error) {
-	credentialTypeID, err := c.GetCredentialTypeID(ctx, "Machine")
-	if err != nil {
-		return 0, fmt.Errorf("failed to get Machine credential type ID: %s", err)
+	if vaultID != "" {
+		inputs["vault_id"] = vaultID
 	}
 
+	name := c.resourceName("packer-vault-cred")
 	credentialBody := map[string]interface{}{
-		"name":            fmt.Sprintf("packer-winrm-cred-%d", time.Now().Unix()),
-		"description":     "WinRM credential for Packer builds",
+		"name":            name,
+		"description":     c.description("Vault credential for Packer builds"),
 		"credential_type": credentialTypeID,
 		"organization":    orgID,
-		"inputs": map[string]interface{}{
-			"username": username,
-			"password": password,
-		},
+		"inputs":          inputs,
 	}
 
+	return c.createResource(ctx, "vault credential", "/api/controller/v2/credentials/", credentialBody, url.Values{
+		"name": {name},
+	})
+}
+
+func (c *AAPClient) DeleteCredential(ctx context.Context, credentialID int) error {
 	resp, err := c.client.R().
 		SetContext(ctx).
-		SetBody(credentialBody).
-		Post("/api/controller/v2/credentials/")
+		Delete(fmt.Sprintf("/api/controller/v2/credentials/%d/", credentialID))
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to create WinRM credential: %s", err)
+		return fmt.Errorf("failed to delete credential: %w", err)
 	}
 	if resp.IsError() {
-		return 0, fmt.Errorf("failed to create WinRM credential: %s (status: %d)", resp.String(), resp.StatusCode())
-	}
-
-	var result struct {
-		ID int `json:"id"`
-	}
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return 0, fmt.Errorf("failed to parse WinRM credential response: %s", err)
-	}
-
-	if result.ID == 0 {
-		return 0, fmt.Errorf("failed to create WinRM credential. Response: %s", resp.String())
+		return fmt.Errorf("failed to delete credential: %w", newAPIError(resp))
 	}
-
-	return result.ID, nil
+	return nil
 }
 
 func (c *AAPClient) LaunchJob(
 	ctx context.Context,
-	invID, jobTemplateID, workflowTemplateID, credentialID int,
+	invID, jobTemplateID, workflowTemplateID int,
+	credentialIDs []int,
 	extraVars map[string]interface{},
 ) (int, error) {
 	launch := map[string]interface{}{
@@ -404,9 +574,10 @@ func (c *AAPClient) LaunchJob(
 		"extra_vars": extraVars,
 	}
 
-	// Add credential if provided
-	if credentialID != 0 {
-		launch["credentials"] = []int{credentialID}
+	// Credentials sent at launch replace all of the template's credentials,
+	// so callers must pass the complete set.
+	if len(credentialIDs) > 0 {
+		launch["credentials"] = credentialIDs
 	}
 
 	// pick the right endpoint
@@ -425,65 +596,84 @@ func (c *AAPClient) LaunchJob(
 		SetBody(launch).
 		Post(endpoint)
 	if err != nil {
-		return 0, fmt.Errorf("failed to launch job: %s", err)
+		return 0, fmt.Errorf("failed to launch job: %w", err)
 	}
 	if resp.IsError() {
-		return 0, fmt.Errorf(
-			"failed to launch job: %s (status: %d)",
-			resp.String(),
-			resp.StatusCode(),
-		)
+		return 0, fmt.Errorf("failed to launch job: %w", newAPIError(resp))
 	}
 
-	// parse the job ID
+	// parse the job ID; workflow launches return the workflow job instead
 	var result struct {
-		Job int `json:"job"`
+		Job         int `json:"job"`
+		WorkflowJob int `json:"workflow_job"`
+		ID          int `json:"id"`
 	}
 	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return 0, fmt.Errorf("failed to parse job launch response: %s", err)
+		return 0, fmt.Errorf("failed to parse job launch response: %w", err)
+	}
+	switch {
+	case result.Job != 0:
+		return result.Job, nil
+	case result.WorkflowJob != 0:
+		return result.WorkflowJob, nil
+	case result.ID != 0:
+		return result.ID, nil
 	}
-	return result.Job, nil
+	return 0, errors.New("job launch response did not include a job ID")
 }
 
-func (c *AAPClient) PollJob(ctx context.Context, jobID int, timeout, pollInterval time.Duration) error {
-	start := time.Now()
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(pollInterval):
-			var result struct {
-				Status string `json:"status"`
-				Failed bool   `json:"failed"`
-			}
-			resp, err := c.client.R().SetContext(ctx).SetResult(&result).Get(fmt.Sprintf("/api/controller/v2/jobs/%d/", jobID))
-			if err != nil || resp.IsError() {
-				return fmt.Errorf("failed to poll job %d: %s", jobID, err)
-			}
-			if result.Status == "successful" {
-				return nil
-			}
-			if result.Status == "failed" || result.Failed {
-				return fmt.Errorf("job %d failed", jobID)
-			}
-		}
-		if time.Since(start) > timeout {
-			return errors.New("timeout waiting for job completion")
-		}
+// RelaunchJob relaunches a finished job with the same inventory,
+// credentials and extra vars and returns the new job's ID. hosts is "all" or
+// "failed"; the latter limits the run to the hosts that failed or were
+// unreachable.
+func (c *AAPClient) RelaunchJob(ctx context.Context, jobID int, hosts string) (int, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(map[string]interface{}{"hosts": hosts}).
+		Post(fmt.Sprintf("/api/controller/v2/jobs/%d/relaunch/", jobID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to relaunch job %d: %w", jobID, err)
+	}
+	if resp.IsError() {
+		return 0, fmt.Errorf("failed to relaunch job %d: %w", jobID, newAPIError(resp))
+	}
+
+	var result struct {
+		Job int `json:"job"`
+		ID  int `json:"id"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse job relaunch response: %w", err)
+	}
+	switch {
+	case result.Job != 0:
+		return result.Job, nil
+	case result.ID != 0:
+		return result.ID, nil
 	}
+	return 0, fmt.Errorf("relaunch of job %d did not return a job ID", jobID)
 }
 
 func (c *AAPClient) GetJobStdout(ctx context.Context, jobID int) (string, error) {
+	return c.stdout(ctx, KindJob, jobID)
+}
+
+// GetAdHocCommandStdout returns the output of an ad hoc command.
+func (c *AAPClient) GetAdHocCommandStdout(ctx context.Context, commandID int) (string, error) {
+	return c.stdout(ctx, KindAdHocCommand, commandID)
+}
+
+func (c *AAPClient) stdout(ctx context.Context, kind JobKind, id int) (string, error) {
 	resp, err := c.client.R().
 		SetContext(ctx).
 		SetHeader("Accept", "text/plain").
-		Get(fmt.Sprintf("/api/controller/v2/jobs/%d/stdout/?format=txt", jobID))
+		Get(kind.url(id, "stdout") + "?format=txt")
 
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch job stdout: %s", err)
+		return "", fmt.Errorf("failed to fetch job stdout: %w", err)
 	}
 	if resp.IsError() {
-		return "", fmt.Errorf("failed to fetch job stdout: %s (status: %d)", resp.String(), resp.StatusCode())
+		return "", fmt.Errorf("failed to fetch job stdout: %w", newAPIError(resp))
 	}
 
 	return resp.String(), nil
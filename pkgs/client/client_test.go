@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -131,7 +133,7 @@ func TestAAPClient_CreateHost(t *testing.T) {
 		Username: "ec2-user",
 	}
 
-	hostID, err := c.CreateHost(t.Context(), 123, details, "ssh_key")
+	hostID, err := c.CreateHost(t.Context(), 123, details)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -165,7 +167,7 @@ func TestAAPClient_LaunchJob(t *testing.T) {
 		InsecureSkipVerify: true,
 	})
 
-	jobID, err := c.LaunchJob(t.Context(), 123, 42, 0, 0, map[string]interface{}{
+	jobID, err := c.LaunchJob(t.Context(), 123, 42, 0, nil, map[string]interface{}{
 		"key1": "value1",
 		"key2": "value2",
 	})
@@ -202,7 +204,7 @@ func TestAAPClient_LaunchWorkflowJob(t *testing.T) {
 		InsecureSkipVerify: true,
 	})
 
-	jobID, err := c.LaunchJob(t.Context(), 123, 0, 84, 0, nil)
+	jobID, err := c.LaunchJob(t.Context(), 123, 0, 84, nil, nil)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -234,7 +236,7 @@ func TestAAPClient_PollJob_Failed(t *testing.T) {
 	})
 	ctx := t.Context()
 
-	err := c.PollJob(ctx, 999, 30*time.Second, 100*time.Millisecond)
+	err := c.PollJob(ctx, 999, client.PollOptions{Timeout: 30 * time.Second, PollInterval: 100 * time.Millisecond})
 	if err == nil {
 		t.Fatal("Expected error for failed job, got nil")
 	}
@@ -261,7 +263,7 @@ func TestAAPClient_PollJob_Timeout(t *testing.T) {
 	})
 	ctx := t.Context()
 
-	err := c.PollJob(ctx, 999, 200*time.Millisecond, 100*time.Millisecond)
+	err := c.PollJob(ctx, 999, client.PollOptions{Timeout: 200 * time.Millisecond, PollInterval: 100 * time.Millisecond})
 	if err == nil {
 		t.Fatal("Expected timeout error, got nil")
 	}
@@ -304,28 +306,130 @@ func TestAAPClient_DeleteOperations(t *testing.T) {
 	}
 }
 
-func TestAAPClient_CreateCredential(t *testing.T) {
-	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" && r.URL.Path == "/api/controller/v2/credential_types/" {
-			response := map[string]interface{}{
-				"results": []map[string]interface{}{
-					{"id": 4, "name": "Machine"},
-				},
+func TestAAPClient_CreateMachineCredential(t *testing.T) {
+	tests := []struct {
+		name       string
+		cred       client.MachineCredential
+		wantInputs map[string]interface{}
+	}{
+		{
+			name:       "ssh key",
+			cred:       client.MachineCredential{Username: "testuser", SSHKeyData: "test-private-key"},
+			wantInputs: map[string]interface{}{"username": "testuser", "ssh_key_data": "test-private-key"},
+		},
+		{
+			name:       "password",
+			cred:       client.MachineCredential{Username: "testuser", Password: "testpass"},
+			wantInputs: map[string]interface{}{"username": "testuser", "password": "testpass"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" && r.URL.Path == "/api/controller/v2/credential_types/" {
+					response := map[string]interface{}{
+						"results": []map[string]interface{}{
+							{"id": 4, "name": "Machine", "kind": "ssh"},
+						},
+					}
+					if err := json.NewEncoder(w).Encode(response); err != nil {
+						t.Errorf("Failed to encode credential types response: %v", err)
+					}
+					return
+				}
+
+				if r.Method != "POST" {
+					t.Errorf("Expected POST request, got %s", r.Method)
+				}
+				if r.URL.Path != "/api/controller/v2/credentials/" {
+					t.Errorf("Expected path /api/controller/v2/credentials/, got %s", r.URL.Path)
+				}
+				var body struct {
+					CredentialType int                    `json:"credential_type"`
+					Inputs         map[string]interface{} `json:"inputs"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("Failed to decode request body: %v", err)
+				}
+				if body.CredentialType != 4 {
+					t.Errorf("Expected credential type 4, got %d", body.CredentialType)
+				}
+				if !reflect.DeepEqual(body.Inputs, tt.wantInputs) {
+					t.Errorf("Expected inputs %v, got %v", tt.wantInputs, body.Inputs)
+				}
+
+				response := map[string]interface{}{"id": 789}
+				if err := json.NewEncoder(w).Encode(response); err != nil {
+					t.Errorf("Failed to encode response: %v", err)
+				}
+			}))
+			defer server.Close()
+
+			c := client.NewAAPClient(config.Config{
+				TowerHost:          server.URL,
+				Username:           "admin",
+				Password:           "secret",
+				Timeout:            30 * time.Second,
+				InsecureSkipVerify: true,
+			})
+
+			credentialID, err := c.CreateMachineCredential(t.Context(), 1, tt.cred)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
 			}
-			if err := json.NewEncoder(w).Encode(response); err != nil {
-				t.Errorf("Failed to encode credential types response: %v", err)
+
+			if credentialID != 789 {
+				t.Errorf("Expected credential ID 789, got %d", credentialID)
 			}
-			return
+		})
+	}
+}
+
+func TestAAPClient_DeleteCredential(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("Expected DELETE request, got %s", r.Method)
+		}
+		if r.URL.Path != "/api/controller/v2/credentials/789/" {
+			t.Errorf("Expected path /api/controller/v2/credentials/789/, got %s", r.URL.Path)
 		}
 
-		if r.Method != "POST" {
-			t.Errorf("Expected POST request, got %s", r.Method)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		Username:           "admin",
+		Password:           "secret",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+	ctx := t.Context()
+
+	err := c.DeleteCredential(ctx, 789)
+	if err != nil {
+		t.Fatalf("Expected no error deleting credential, got %v", err)
+	}
+}
+
+func TestAAPClient_GetCredentialTypeID(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Expected GET request, got %s", r.Method)
 		}
-		if r.URL.Path != "/api/controller/v2/credentials/" {
-			t.Errorf("Expected path /api/controller/v2/credentials/, got %s", r.URL.Path)
+		if r.URL.Path != "/api/controller/v2/credential_types/" {
+			t.Errorf("Expected path /api/controller/v2/credential_types/, got %s", r.URL.Path)
 		}
 
-		response := map[string]interface{}{"id": 789}
+		response := map[string]interface{}{
+			"results": []map[string]interface{}{
+				{"id": 4, "name": "Machine"},
+				{"id": 2, "name": "Source Control"},
+				{"id": 3, "name": "Vault"},
+			},
+		}
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			t.Errorf("Failed to encode response: %v", err)
 		}
@@ -340,38 +444,84 @@ func TestAAPClient_CreateCredential(t *testing.T) {
 		InsecureSkipVerify: true,
 	})
 
-	credentialID, err := c.CreateCredential(t.Context(), 1, "testuser", "test-private-key")
+	// Test finding existing credential type
+	credentialTypeID, err := c.GetCredentialTypeID(t.Context(), "Machine")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
+	if credentialTypeID != 4 {
+		t.Errorf("Expected credential type ID 4, got %d", credentialTypeID)
+	}
 
-	if credentialID != 789 {
-		t.Errorf("Expected credential ID 789, got %d", credentialID)
+	// Test finding non-existing credential type
+	_, err = c.GetCredentialTypeID(t.Context(), "NonExistent")
+	if err == nil {
+		t.Fatal("Expected error for non-existent credential type, got nil")
 	}
 }
 
-func TestAAPClient_CreatePasswordCredential(t *testing.T) {
+func TestAAPClient_CreateInventory_AmbiguousFailureCommitted(t *testing.T) {
+	posts := 0
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" && r.URL.Path == "/api/controller/v2/credential_types/" {
+		switch r.Method {
+		case "POST":
+			// The server commits the inventory but the response never makes it back intact.
+			posts++
+			w.WriteHeader(http.StatusGatewayTimeout)
+		case "GET":
+			if !strings.HasPrefix(r.URL.Query().Get("name"), "packer-inv-") {
+				t.Errorf("Expected lookup by run marker name, got %q", r.URL.RawQuery)
+			}
 			response := map[string]interface{}{
-				"results": []map[string]interface{}{
-					{"id": 4, "name": "Machine"},
-				},
+				"count":   1,
+				"results": []map[string]interface{}{{"id": 321}},
 			}
 			if err := json.NewEncoder(w).Encode(response); err != nil {
-				t.Errorf("Failed to encode credential types response: %v", err)
+				t.Errorf("Failed to encode response: %v", err)
 			}
-			return
 		}
+	}))
+	defer server.Close()
 
-		if r.Method != "POST" {
-			t.Errorf("Expected POST request, got %s", r.Method)
-		}
-		if r.URL.Path != "/api/controller/v2/credentials/" {
-			t.Errorf("Expected path /api/controller/v2/credentials/, got %s", r.URL.Path)
-		}
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		Username:           "admin",
+		Password:           "secret",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+
+	inventoryID, err := c.CreateInventory(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if inventoryID != 321 {
+		t.Errorf("Expected inventory ID 321, got %d", inventoryID)
+	}
+	if posts != 1 {
+		t.Errorf("Expected 1 POST request, got %d", posts)
+	}
+}
 
-		response := map[string]interface{}{"id": 790}
+func TestAAPClient_CreateInventory_LastAttemptCommitted(t *testing.T) {
+	posts, lookups := 0, 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]interface{}{"count": 0, "results": []map[string]interface{}{}}
+		switch r.Method {
+		case "POST":
+			// Every attempt fails, but the last one is committed.
+			posts++
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		case "GET":
+			lookups++
+			if posts == 3 {
+				response = map[string]interface{}{
+					"count":   1,
+					"results": []map[string]interface{}{{"id": 321}},
+				}
+			}
+		}
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			t.Errorf("Failed to encode response: %v", err)
 		}
@@ -386,38 +536,72 @@ func TestAAPClient_CreatePasswordCredential(t *testing.T) {
 		InsecureSkipVerify: true,
 	})
 
-	credentialID, err := c.CreatePasswordCredential(t.Context(), 1, "testuser", "testpass")
+	inventoryID, err := c.CreateInventory(t.Context(), 1)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
-
-	if credentialID != 790 {
-		t.Errorf("Expected credential ID 790, got %d", credentialID)
+	if inventoryID != 321 {
+		t.Errorf("Expected inventory ID 321, got %d", inventoryID)
+	}
+	if posts != 3 {
+		t.Errorf("Expected 3 POST requests, got %d", posts)
+	}
+	if lookups != 3 {
+		t.Errorf("Expected 3 lookups, got %d", lookups)
 	}
 }
 
-func TestAAPClient_CreateWinRMCredential(t *testing.T) {
+func TestAAPClient_CreateInventory_AllAttemptsFail(t *testing.T) {
+	posts := 0
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" && r.URL.Path == "/api/controller/v2/credential_types/" {
-			response := map[string]interface{}{
-				"results": []map[string]interface{}{
-					{"id": 4, "name": "Machine"},
-				},
-			}
-			if err := json.NewEncoder(w).Encode(response); err != nil {
-				t.Errorf("Failed to encode credential types response: %v", err)
-			}
+		if r.Method == "POST" {
+			posts++
+			w.WriteHeader(http.StatusServiceUnavailable)
 			return
 		}
-
-		if r.Method != "POST" {
-			t.Errorf("Expected POST request, got %s", r.Method)
-		}
-		if r.URL.Path != "/api/controller/v2/credentials/" {
-			t.Errorf("Expected path /api/controller/v2/credentials/, got %s", r.URL.Path)
+		response := map[string]interface{}{"count": 0, "results": []map[string]interface{}{}}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
 		}
+	}))
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		Username:           "admin",
+		Password:           "secret",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
 
-		response := map[string]interface{}{"id": 791}
+	_, err := c.CreateInventory(t.Context(), 1)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("Expected an error after 3 attempts, got %v", err)
+	}
+	if posts != 3 {
+		t.Errorf("Expected 3 POST requests, got %d", posts)
+	}
+}
+
+func TestAAPClient_CreateCredential_AmbiguousFailureRetried(t *testing.T) {
+	posts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response map[string]interface{}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/controller/v2/credential_types/":
+			response = map[string]interface{}{
+				"results": []map[string]interface{}{{"id": 4, "name": "Machine", "kind": "ssh"}},
+			}
+		case r.Method == "GET":
+			response = map[string]interface{}{"count": 0, "results": []map[string]interface{}{}}
+		case r.Method == "POST":
+			posts++
+			if posts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			response = map[string]interface{}{"id": 789}
+		}
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			t.Errorf("Failed to encode response: %v", err)
 		}
@@ -432,26 +616,37 @@ func TestAAPClient_CreateWinRMCredential(t *testing.T) {
 		InsecureSkipVerify: true,
 	})
 
-	credentialID, err := c.CreateWinRMCredential(t.Context(), 1, "testuser", "testpass")
+	credentialID, err := c.CreateMachineCredential(t.Context(), 1, client.MachineCredential{Username: "testuser", SSHKeyData: "test-private-key"})
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
-
-	if credentialID != 791 {
-		t.Errorf("Expected credential ID 791, got %d", credentialID)
+	if credentialID != 789 {
+		t.Errorf("Expected credential ID 789, got %d", credentialID)
+	}
+	if posts != 2 {
+		t.Errorf("Expected 2 POST requests, got %d", posts)
 	}
 }
 
-func TestAAPClient_DeleteCredential(t *testing.T) {
+func TestAAPClient_CredentialTypeLookupIsCached(t *testing.T) {
+	typeLookups := 0
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "DELETE" {
-			t.Errorf("Expected DELETE request, got %s", r.Method)
+		var response map[string]interface{}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/controller/v2/credential_types/":
+			typeLookups++
+			if got := r.URL.Query().Get("name"); got != "Machine" {
+				t.Errorf("Expected lookup filtered by name=Machine, got %q", r.URL.RawQuery)
+			}
+			response = map[string]interface{}{
+				"results": []map[string]interface{}{{"id": 4, "name": "Machine", "kind": "ssh"}},
+			}
+		case r.Method == "POST":
+			response = map[string]interface{}{"id": 789}
 		}
-		if r.URL.Path != "/api/controller/v2/credentials/789/" {
-			t.Errorf("Expected path /api/controller/v2/credentials/789/, got %s", r.URL.Path)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
 		}
-
-		w.WriteHeader(http.StatusNoContent)
 	}))
 	defer server.Close()
 
@@ -462,30 +657,63 @@ func TestAAPClient_DeleteCredential(t *testing.T) {
 		Timeout:            30 * time.Second,
 		InsecureSkipVerify: true,
 	})
-	ctx := t.Context()
 
-	err := c.DeleteCredential(ctx, 789)
+	if _, err := c.CreateMachineCredential(t.Context(), 1, client.MachineCredential{Username: "testuser", SSHKeyData: "test-private-key"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := c.CreateMachineCredential(t.Context(), 1, client.MachineCredential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := c.CreateMachineCredential(t.Context(), 1, client.MachineCredential{Username: "testuser", Password: "testpass"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	id, err := c.LookupCredentialType(t.Context(), "Machine", "ssh")
 	if err != nil {
-		t.Fatalf("Expected no error deleting credential, got %v", err)
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if id != 4 {
+		t.Errorf("Expected credential type ID 4, got %d", id)
+	}
+
+	// Machine credentials are looked up by name and kind, so the explicit
+	// lookup is served from the cache.
+	if typeLookups != 1 {
+		t.Errorf("Expected 1 credential type lookup, got %d", typeLookups)
 	}
 }
 
-func TestAAPClient_GetCredentialTypeID(t *testing.T) {
+func TestAAPClient_CreateVaultCredential(t *testing.T) {
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" {
-			t.Errorf("Expected GET request, got %s", r.Method)
-		}
-		if r.URL.Path != "/api/controller/v2/credential_types/" {
-			t.Errorf("Expected path /api/controller/v2/credential_types/, got %s", r.URL.Path)
+		if r.Method == "GET" && r.URL.Path == "/api/controller/v2/credential_types/" {
+			if r.URL.Query().Get("kind") != "vault" {
+				t.Errorf("Expected credential type lookup by kind=vault, got %q", r.URL.RawQuery)
+			}
+			response := map[string]interface{}{
+				"results": []map[string]interface{}{
+					{"id": 3, "name": "Vault", "kind": "vault"},
+				},
+			}
+			if err := json.NewEncoder(w).Encode(response); err != nil {
+				t.Errorf("Failed to encode credential types response: %v", err)
+			}
+			return
 		}
 
-		response := map[string]interface{}{
-			"results": []map[string]interface{}{
-				{"id": 4, "name": "Machine"},
-				{"id": 2, "name": "Source Control"},
-				{"id": 3, "name": "Vault"},
-			},
+		var body struct {
+			CredentialType int               `json:"credential_type"`
+			Inputs         map[string]string `json:"inputs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if body.CredentialType != 3 {
+			t.Errorf("Expected credential type 3, got %d", body.CredentialType)
 		}
+		if body.Inputs["vault_password"] != "vault-secret" || body.Inputs["vault_id"] != "prod" {
+			t.Errorf("Unexpected vault inputs: %v", body.Inputs)
+		}
+
+		response := map[string]interface{}{"id": 792}
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			t.Errorf("Failed to encode response: %v", err)
 		}
@@ -500,18 +728,11 @@ func TestAAPClient_GetCredentialTypeID(t *testing.T) {
 		InsecureSkipVerify: true,
 	})
 
-	// Test finding existing credential type
-	credentialTypeID, err := c.GetCredentialTypeID(t.Context(), "Machine")
+	credentialID, err := c.CreateVaultCredential(t.Context(), 1, "vault-secret", "prod")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
-	if credentialTypeID != 4 {
-		t.Errorf("Expected credential type ID 4, got %d", credentialTypeID)
-	}
-
-	// Test finding non-existing credential type
-	_, err = c.GetCredentialTypeID(t.Context(), "NonExistent")
-	if err == nil {
-		t.Fatal("Expected error for non-existent credential type, got nil")
+	if credentialID != 792 {
+		t.Errorf("Expected credential ID 792, got %d", credentialID)
 	}
 }
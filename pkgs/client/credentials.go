@@ -0,0 +1,272 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Credential is an existing credential as attached to a template or a launch.
+type Credential struct {
+	ID               int
+	Name             string
+	CredentialTypeID int
+	// Kind is the kind of the credential type, e.g. "ssh", "vault" or "cloud".
+	Kind string
+	// VaultID is the vault identifier of a Vault credential, if any.
+	VaultID string
+}
+
+// credentialJSON is the controller's representation of a credential.
+type credentialJSON struct {
+	ID             int                    `json:"id"`
+	Name           string                 `json:"name"`
+	CredentialType int                    `json:"credential_type"`
+	Kind           string                 `json:"kind"`
+	Inputs         map[string]interface{} `json:"inputs"`
+}
+
+func (j credentialJSON) credential() Credential {
+	cred := Credential{
+		ID:               j.ID,
+		Name:             j.Name,
+		CredentialTypeID: j.CredentialType,
+		Kind:             j.Kind,
+	}
+	if vaultID, ok := j.Inputs["vault_id"].(string); ok {
+		cred.VaultID = vaultID
+	}
+	return cred
+}
+
+// slot identifies the launch slot a credential occupies. AAP accepts one
+// credential per credential type, except for Vault credentials which are
+// unique per vault ID.
+func (c Credential) slot() string {
+	if c.Kind == "vault" {
+		return fmt.Sprintf("%d/%s", c.CredentialTypeID, c.VaultID)
+	}
+	return fmt.Sprint(c.CredentialTypeID)
+}
+
+// MergeCredentials returns the template's default credentials with every
+// override applied. An override replaces the default credential of the same
+// credential type (or the same vault ID for Vault credentials), following
+// AAP's launch-time replacement rules.
+func MergeCredentials(defaults, overrides []Credential) []Credential {
+	replaced := make(map[string]bool, len(overrides))
+	for _, o := range overrides {
+		replaced[o.slot()] = true
+	}
+
+	var merged []Credential
+	for _, d := range defaults {
+		if !replaced[d.slot()] {
+			merged = append(merged, d)
+		}
+	}
+
+	seen := make(map[string]bool, len(overrides))
+	for _, o := range overrides {
+		if seen[o.slot()] {
+			continue
+		}
+		seen[o.slot()] = true
+		merged = append(merged, o)
+	}
+	return merged
+}
+
+// GetTemplateCredentials returns the default credentials of a job template.
+func (c *AAPClient) GetTemplateCredentials(ctx context.Context, jobTemplateID int) ([]Credential, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetQueryParam("page_size", "200").
+		Get(fmt.Sprintf("/api/controller/v2/job_templates/%d/credentials/", jobTemplateID))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch template credentials: %w", err)
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("failed to fetch template credentials: %w", newAPIError(resp))
+	}
+
+	var result struct {
+		Results []credentialJSON `json:"results"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse template credentials response: %w", err)
+	}
+
+	creds := make([]Credential, 0, len(result.Results))
+	for _, r := range result.Results {
+		creds = append(creds, r.credential())
+	}
+	return creds, nil
+}
+
+// GetCredential returns the credential with the given ID.
+func (c *AAPClient) GetCredential(ctx context.Context, credentialID int) (Credential, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(fmt.Sprintf("/api/controller/v2/credentials/%d/", credentialID))
+
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to fetch credential: %w", err)
+	}
+	if resp.IsError() {
+		return Credential{}, fmt.Errorf("failed to fetch credential: %w", newAPIError(resp))
+	}
+
+	var result credentialJSON
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return Credential{}, fmt.Errorf("failed to parse credential response: %w", err)
+	}
+	return result.credential(), nil
+}
+
+// FindCredential returns the credential with the given name. It fails if the
+// name is ambiguous.
+func (c *AAPClient) FindCredential(ctx context.Context, name string) (Credential, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetQueryParamsFromValues(url.Values{"name": {name}}).
+		Get("/api/controller/v2/credentials/")
+
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to look up credential %q: %w", name, err)
+	}
+	if resp.IsError() {
+		return Credential{}, fmt.Errorf("failed to look up credential %q: %w", name, newAPIError(resp))
+	}
+
+	var result struct {
+		Results []credentialJSON `json:"results"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return Credential{}, fmt.Errorf("failed to parse credentials response: %w", err)
+	}
+
+	switch len(result.Results) {
+	case 0:
+		return Credential{}, fmt.Errorf("credential %q not found", name)
+	case 1:
+		return result.Results[0].credential(), nil
+	default:
+		return Credential{}, fmt.Errorf("credential name %q is ambiguous (%d matches), use credential_ids instead", name, len(result.Results))
+	}
+}
+
+// CredentialTypeDefinition describes a custom credential type.
+type CredentialTypeDefinition struct {
+	Name      string
+	Kind      string
+	Inputs    map[string]interface{}
+	Injectors map[string]interface{}
+}
+
+// SecretVarsCredentialType returns a custom credential type with one secret
+// string input per key. Its injector exposes the inputs as extra vars, or as
+// environment variables when injector is "env". The name is derived from the
+// keys and the injector, so builds with the same secret_vars share the type.
+func SecretVarsCredentialType(keys []string, injector string) CredentialTypeDefinition {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	fields := make([]map[string]interface{}, 0, len(sorted))
+	values := make(map[string]interface{}, len(sorted))
+	for _, key := range sorted {
+		fields = append(fields, map[string]interface{}{
+			"id":     key,
+			"label":  key,
+			"type":   "string",
+			"secret": true,
+		})
+		values[key] = fmt.Sprintf("{{ %s }}", key)
+	}
+
+	if injector != "env" {
+		injector = "extra_vars"
+	}
+	sum := sha256.Sum256([]byte(injector + ":" + strings.Join(sorted, ",")))
+
+	return CredentialTypeDefinition{
+		Name: "packer-secret-vars-" + hex.EncodeToString(sum[:])[:12],
+		Kind: "cloud",
+		Inputs: map[string]interface{}{
+			"fields":   fields,
+			"required": sorted,
+		},
+		Injectors: map[string]interface{}{
+			injector: values,
+		},
+	}
+}
+
+// CreateCredentialType registers a custom credential type.
+func (c *AAPClient) CreateCredentialType(ctx context.Context, def CredentialTypeDefinition) (int, error) {
+	body := map[string]interface{}{
+		"name":        def.Name,
+		"description": c.description("Credential type for Packer builds"),
+		"kind":        def.Kind,
+		"inputs":      def.Inputs,
+		"injectors":   def.Injectors,
+	}
+
+	id, err := c.createResource(ctx, "credential type", "/api/controller/v2/credential_types/", body, url.Values{
+		"name": {def.Name},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.credentialTypesMu.Lock()
+	c.credentialTypes[def.Kind+"/"+def.Name] = id
+	c.credentialTypesMu.Unlock()
+	return id, nil
+}
+
+// DeleteCredentialType deletes a custom credential type. The controller
+// refuses with 409 Conflict while credentials of the type still exist.
+func (c *AAPClient) DeleteCredentialType(ctx context.Context, credentialTypeID int) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(fmt.Sprintf("/api/controller/v2/credential_types/%d/", credentialTypeID))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete credential type: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to delete credential type: %w", newAPIError(resp))
+	}
+
+	c.credentialTypesMu.Lock()
+	for key, id := range c.credentialTypes {
+		if id == credentialTypeID {
+			delete(c.credentialTypes, key)
+		}
+	}
+	c.credentialTypesMu.Unlock()
+	return nil
+}
+
+// CreateCustomCredential creates a temporary credential of the given type.
+func (c *AAPClient) CreateCustomCredential(ctx context.Context, orgID, credentialTypeID int, inputs map[string]interface{}) (int, error) {
+	name := c.resourceName(fmt.Sprintf("packer-cred-%d", credentialTypeID))
+	credentialBody := map[string]interface{}{
+		"name":            name,
+		"description":     c.description("Credential for Packer builds"),
+		"credential_type": credentialTypeID,
+		"organization":    orgID,
+		"inputs":          inputs,
+	}
+
+	return c.createResource(ctx, "credential", "/api/controller/v2/credentials/", credentialBody, url.Values{
+		"name": {name},
+	})
+}
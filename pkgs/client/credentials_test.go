@@ -0,0 +1,103 @@
+package client_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
+)
+
+func TestMergeCredentials(t *testing.T) {
+	machine := client.Credential{ID: 1, Name: "shared machine", CredentialTypeID: 1, Kind: "ssh"}
+	aws := client.Credential{ID: 2, Name: "aws", CredentialTypeID: 5, Kind: "cloud"}
+	vaultDev := client.Credential{ID: 3, Name: "vault dev", CredentialTypeID: 3, Kind: "vault", VaultID: "dev"}
+
+	tempMachine := client.Credential{ID: 10, Name: "temp", CredentialTypeID: 1, Kind: "ssh"}
+	awsProd := client.Credential{ID: 11, Name: "aws prod", CredentialTypeID: 5, Kind: "cloud"}
+	vaultProd := client.Credential{ID: 12, Name: "vault prod", CredentialTypeID: 3, Kind: "vault", VaultID: "prod"}
+
+	got := client.MergeCredentials(
+		[]client.Credential{machine, aws, vaultDev},
+		[]client.Credential{tempMachine, awsProd, vaultProd},
+	)
+	want := []client.Credential{vaultDev, tempMachine, awsProd, vaultProd}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeCredentials() = %v, want %v", got, want)
+	}
+
+	// The first override of a type wins.
+	got = client.MergeCredentials(nil, []client.Credential{tempMachine, machine})
+	if !reflect.DeepEqual(got, []client.Credential{tempMachine}) {
+		t.Errorf("Expected only the first machine credential, got %v", got)
+	}
+}
+
+func TestAAPClient_GetTemplateCredentials(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/controller/v2/job_templates/42/credentials/" {
+			t.Errorf("Expected path /api/controller/v2/job_templates/42/credentials/, got %s", r.URL.Path)
+		}
+
+		response := map[string]interface{}{
+			"results": []map[string]interface{}{
+				{"id": 1, "name": "shared machine", "credential_type": 1, "kind": "ssh", "inputs": map[string]interface{}{"username": "ec2-user"}},
+				{"id": 3, "name": "vault dev", "credential_type": 3, "kind": "vault", "inputs": map[string]interface{}{"vault_id": "dev", "vault_password": "$encrypted$"}},
+			},
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		AccessToken:        "token123",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+
+	creds, err := c.GetTemplateCredentials(t.Context(), 42)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []client.Credential{
+		{ID: 1, Name: "shared machine", CredentialTypeID: 1, Kind: "ssh"},
+		{ID: 3, Name: "vault dev", CredentialTypeID: 3, Kind: "vault", VaultID: "dev"},
+	}
+	if !reflect.DeepEqual(creds, want) {
+		t.Errorf("GetTemplateCredentials() = %v, want %v", creds, want)
+	}
+}
+
+func TestSecretVarsCredentialType(t *testing.T) {
+	def := client.SecretVarsCredentialType([]string{"b_token", "a_password"}, "env")
+	same := client.SecretVarsCredentialType([]string{"a_password", "b_token"}, "env")
+	other := client.SecretVarsCredentialType([]string{"a_password", "b_token"}, "extra_vars")
+
+	if def.Name != same.Name {
+		t.Errorf("Expected the name to be independent of key order, got %s and %s", def.Name, same.Name)
+	}
+	if def.Name == other.Name {
+		t.Errorf("Expected the name to depend on the injector, got %s for both", def.Name)
+	}
+	if def.Kind != "cloud" {
+		t.Errorf("Expected kind cloud, got %s", def.Kind)
+	}
+
+	env, ok := def.Injectors["env"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected env injector, got %v", def.Injectors)
+	}
+	if env["a_password"] != "{{ a_password }}" {
+		t.Errorf("Expected a_password to be injected from its input, got %v", env["a_password"])
+	}
+	if !reflect.DeepEqual(def.Inputs["required"], []string{"a_password", "b_token"}) {
+		t.Errorf("Expected all inputs to be required, got %v", def.Inputs["required"])
+	}
+}
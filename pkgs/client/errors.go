@@ -0,0 +1,144 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	resty "github.com/go-resty/resty/v2"
+)
+
+// APIError is returned by AAPClient methods when the controller answers with
+// an HTTP error status. Use errors.As to inspect it.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Detail is the controller's top-level "detail" (or "error") message, if any.
+	Detail string
+	// FieldErrors holds per-field validation messages keyed by field name.
+	// Nested fields are joined with a dot, e.g. "inputs.ssh_key_data".
+	FieldErrors map[string][]string
+	// Body is the raw response body.
+	Body string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s returned %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+
+	var parts []string
+	if e.Detail != "" {
+		parts = append(parts, e.Detail)
+	}
+	for _, field := range e.fieldNames() {
+		parts = append(parts, fmt.Sprintf("%s: %s", field, strings.Join(e.FieldErrors[field], " ")))
+	}
+	if len(parts) == 0 && e.Body != "" {
+		parts = append(parts, e.Body)
+	}
+	if len(parts) > 0 {
+		msg += ": " + strings.Join(parts, "; ")
+	}
+	return msg
+}
+
+// fieldNames returns the keys of FieldErrors in a stable order.
+func (e *APIError) fieldNames() []string {
+	names := make([]string, 0, len(e.FieldErrors))
+	for name := range e.FieldErrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newAPIError builds an APIError from an error response.
+func newAPIError(resp *resty.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode(),
+		Body:       strings.TrimSpace(resp.String()),
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.Path = resp.Request.URL
+	}
+	if resp.RawResponse != nil && resp.RawResponse.Request != nil {
+		apiErr.Path = resp.RawResponse.Request.URL.Path
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(resp.Body(), &body); err != nil {
+		return apiErr
+	}
+	for key, value := range body {
+		switch key {
+		case "detail", "error":
+			apiErr.Detail = strings.Join(flattenMessages(value), " ")
+		default:
+			apiErr.addFieldErrors(key, value)
+		}
+	}
+	return apiErr
+}
+
+// addFieldErrors records the validation messages found in value under field.
+func (e *APIError) addFieldErrors(field string, value interface{}) {
+	if nested, ok := value.(map[string]interface{}); ok {
+		for key, v := range nested {
+			e.addFieldErrors(field+"."+key, v)
+		}
+		return
+	}
+	if e.FieldErrors == nil {
+		e.FieldErrors = make(map[string][]string)
+	}
+	e.FieldErrors[field] = append(e.FieldErrors[field], flattenMessages(value)...)
+}
+
+// flattenMessages converts a JSON error value (string, list or object) into a list of messages.
+func flattenMessages(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var msgs []string
+		for _, item := range v {
+			msgs = append(msgs, flattenMessages(item)...)
+		}
+		return msgs
+	case nil:
+		return nil
+	default:
+		b, _ := json.Marshal(v)
+		return []string{string(b)}
+	}
+}
+
+// hasStatus reports whether err wraps an APIError with the given status code.
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// IsUnauthorized reports whether err is a 401 response from the controller.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden reports whether err is a 403 response from the controller.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsNotFound reports whether err is a 404 response from the controller.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a 409 response from the controller.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
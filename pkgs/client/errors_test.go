@@ -0,0 +1,105 @@
+package client_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
+)
+
+func TestAPIError_FieldErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(`{"organization": ["Invalid pk \"4\" - object does not exist."], "inputs": {"ssh_key_data": ["Invalid certificate or key"]}}`))
+		if err != nil {
+			t.Fatalf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		Username:           "admin",
+		Password:           "secret",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+
+	_, err := c.CreateInventory(t.Context(), 4)
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+
+	if apiErr.Method != "POST" {
+		t.Errorf("Expected method POST, got %s", apiErr.Method)
+	}
+	if apiErr.Path != "/api/controller/v2/inventories/" {
+		t.Errorf("Expected path /api/controller/v2/inventories/, got %s", apiErr.Path)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", apiErr.StatusCode)
+	}
+	if got := apiErr.FieldErrors["organization"]; len(got) != 1 || !strings.Contains(got[0], "Invalid pk") {
+		t.Errorf("Expected organization field error, got %v", got)
+	}
+	if got := apiErr.FieldErrors["inputs.ssh_key_data"]; len(got) != 1 {
+		t.Errorf("Expected nested inputs.ssh_key_data field error, got %v", apiErr.FieldErrors)
+	}
+}
+
+func TestAPIError_StatusHelpers(t *testing.T) {
+	tests := []struct {
+		status int
+		detail string
+		check  func(error) bool
+	}{
+		{http.StatusUnauthorized, "Authentication credentials were not provided.", client.IsUnauthorized},
+		{http.StatusForbidden, "You do not have permission to perform this action.", client.IsForbidden},
+		{http.StatusNotFound, "Not found.", client.IsNotFound},
+		{http.StatusConflict, "Resource is being used by running jobs.", client.IsConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, err := w.Write([]byte(`{"detail": "` + tt.detail + `"}`))
+				if err != nil {
+					t.Fatalf("Failed to write response: %v", err)
+				}
+			}))
+			defer server.Close()
+
+			c := client.NewAAPClient(config.Config{
+				TowerHost:          server.URL,
+				AccessToken:        "token123",
+				Timeout:            30 * time.Second,
+				InsecureSkipVerify: true,
+			})
+
+			err := c.DeleteInventory(t.Context(), 123)
+			if !tt.check(err) {
+				t.Fatalf("Expected status helper to match error %v", err)
+			}
+
+			var apiErr *client.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected APIError, got %v", err)
+			}
+			if apiErr.Detail != tt.detail {
+				t.Errorf("Expected detail %q, got %q", tt.detail, apiErr.Detail)
+			}
+			if apiErr.Method != "DELETE" || apiErr.Path != "/api/controller/v2/inventories/123/" {
+				t.Errorf("Unexpected request in error: %s %s", apiErr.Method, apiErr.Path)
+			}
+		})
+	}
+}
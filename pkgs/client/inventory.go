@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// marshalVariables encodes inventory, group or host variables the way the
+// controller stores them: as a JSON document in a string field.
+func marshalVariables(vars map[string]interface{}) (string, error) {
+	if len(vars) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal variables: %w", err)
+	}
+	return string(data), nil
+}
+
+// UpdateInventoryVariables replaces the variables of an inventory.
+func (c *AAPClient) UpdateInventoryVariables(ctx context.Context, invID int, vars map[string]interface{}) error {
+	variables, err := marshalVariables(vars)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(map[string]interface{}{"variables": variables}).
+		Patch(fmt.Sprintf("/api/controller/v2/inventories/%d/", invID))
+
+	if err != nil {
+		return fmt.Errorf("failed to update inventory variables: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to update inventory variables: %w", newAPIError(resp))
+	}
+	return nil
+}
+
+// CreateGroup creates a group with the given variables in an inventory.
+func (c *AAPClient) CreateGroup(ctx context.Context, invID int, name string, vars map[string]interface{}) (int, error) {
+	variables, err := marshalVariables(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	groupBody := map[string]interface{}{
+		"name":        name,
+		"description": c.description("Packer build group"),
+		"inventory":   invID,
+		"variables":   variables,
+	}
+
+	return c.createResource(ctx, "group", "/api/controller/v2/groups/", groupBody, url.Values{
+		"name":      {name},
+		"inventory": {fmt.Sprint(invID)},
+	})
+}
+
+// AddHostToGroup makes a host a member of a group. Adding a host that is
+// already a member is a no-op.
+func (c *AAPClient) AddHostToGroup(ctx context.Context, groupID, hostID int) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(map[string]interface{}{"id": hostID}).
+		Post(fmt.Sprintf("/api/controller/v2/groups/%d/hosts/", groupID))
+
+	if err != nil {
+		return fmt.Errorf("failed to add host to group: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to add host to group: %w", newAPIError(resp))
+	}
+	return nil
+}
+
+func (c *AAPClient) DeleteGroup(ctx context.Context, groupID int) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(fmt.Sprintf("/api/controller/v2/groups/%d/", groupID))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to delete group: %w", newAPIError(resp))
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package client_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
+)
+
+func TestHostVars_MergesOverConnectionVars(t *testing.T) {
+	vars := client.HostVars(client.HostDetails{
+		Host:     "10.0.0.5",
+		Port:     22,
+		Username: "ec2-user",
+		Vars: map[string]interface{}{
+			"ansible_user":               "packer",
+			"ansible_python_interpreter": "/usr/bin/python3",
+		},
+	})
+
+	if vars["ansible_user"] != "packer" {
+		t.Errorf("Expected host_vars to override ansible_user, got %v", vars["ansible_user"])
+	}
+	if vars["ansible_python_interpreter"] != "/usr/bin/python3" {
+		t.Errorf("Expected ansible_python_interpreter to be set, got %v", vars["ansible_python_interpreter"])
+	}
+	if vars["ansible_connection"] != "ssh" || vars["ansible_host"] != "10.0.0.5" {
+		t.Errorf("Expected connection vars to be kept, got %v", vars)
+	}
+}
+
+func TestAAPClient_CreateGroupAndAddHost(t *testing.T) {
+	var groupVars map[string]interface{}
+	var memberID int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/controller/v2/groups/":
+			var body struct {
+				Name      string `json:"name"`
+				Inventory int    `json:"inventory"`
+				Variables string `json:"variables"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode request: %v", err)
+			}
+			if body.Name != "webservers" || body.Inventory != 123 {
+				t.Errorf("Expected group webservers in inventory 123, got %s in %d", body.Name, body.Inventory)
+			}
+			if err := json.Unmarshal([]byte(body.Variables), &groupVars); err != nil {
+				t.Errorf("Expected group variables as a JSON document, got %q", body.Variables)
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id": 7}`))
+		case r.Method == "POST" && r.URL.Path == "/api/controller/v2/groups/7/hosts/":
+			var body struct {
+				ID int `json:"id"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode request: %v", err)
+			}
+			memberID = body.ID
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		AccessToken:        "token123",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+
+	groupID, err := c.CreateGroup(t.Context(), 123, "webservers", map[string]interface{}{"http_port": "8080"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if groupID != 7 {
+		t.Errorf("Expected group ID 7, got %d", groupID)
+	}
+	if groupVars["http_port"] != "8080" {
+		t.Errorf("Expected http_port group var, got %v", groupVars)
+	}
+
+	if err := c.AddHostToGroup(t.Context(), groupID, 456); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if memberID != 456 {
+		t.Errorf("Expected host 456 to be added, got %d", memberID)
+	}
+}
+
+func TestAAPClient_UpdateInventoryVariables(t *testing.T) {
+	var variables string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" {
+			t.Errorf("Expected PATCH request, got %s", r.Method)
+		}
+		if r.URL.Path != "/api/controller/v2/inventories/123/" {
+			t.Errorf("Expected path /api/controller/v2/inventories/123/, got %s", r.URL.Path)
+		}
+		var body struct {
+			Variables string `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		variables = body.Variables
+		_, _ = w.Write([]byte(`{"id": 123}`))
+	}))
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		AccessToken:        "token123",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+
+	if err := c.UpdateInventoryVariables(t.Context(), 123, map[string]interface{}{"env": "build"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if variables != `{"env":"build"}` {
+		t.Errorf("Expected inventory variables {\"env\":\"build\"}, got %s", variables)
+	}
+}
+
+func TestHostVars_WinRMDefaults(t *testing.T) {
+	vars := client.HostVars(client.HostDetails{
+		Host:       "10.0.0.6",
+		Port:       5986,
+		Username:   "Administrator",
+		Connection: "winrm",
+	})
+
+	want := map[string]interface{}{
+		"ansible_connection":                   "winrm",
+		"ansible_winrm_scheme":                 "https",
+		"ansible_winrm_transport":              "basic",
+		"ansible_winrm_server_cert_validation": "ignore",
+		"ansible_become_method":                "runas",
+		"ansible_become_user":                  "Administrator",
+	}
+	for key, value := range want {
+		if vars[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, vars[key])
+		}
+	}
+	if _, ok := vars["ansible_winrm_operation_timeout_sec"]; ok {
+		t.Errorf("Expected no operation timeout by default, got %v", vars)
+	}
+}
+
+func TestAAPClient_CreateHost_IPv6Name(t *testing.T) {
+	var name string
+	var hostVars map[string]interface{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name      string `json:"name"`
+			Variables string `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		name = body.Name
+		if err := json.Unmarshal([]byte(body.Variables), &hostVars); err != nil {
+			t.Errorf("Expected host variables as a JSON document, got %q", body.Variables)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 456}`))
+	}))
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		AccessToken:        "token123",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+
+	if _, err := c.CreateHost(t.Context(), 123, client.HostDetails{Host: "2001:db8::5", Port: 22}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if name != "2001-db8--5" {
+		t.Errorf("Expected host name 2001-db8--5, got %s", name)
+	}
+	if hostVars["ansible_host"] != "2001:db8::5" {
+		t.Errorf("Expected bare IPv6 ansible_host, got %v", hostVars["ansible_host"])
+	}
+}
@@ -0,0 +1,651 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// JobEvent is a single event of a playbook run, such as a task start or a
+// host result.
+type JobEvent struct {
+	Counter int                    `json:"counter"`
+	Event   string                 `json:"event"`
+	Host    string                 `json:"host_name"`
+	Task    string                 `json:"task"`
+	Role    string                 `json:"role"`
+	Play    string                 `json:"play"`
+	Stdout  string                 `json:"stdout"`
+	Failed  bool                   `json:"failed"`
+	Changed bool                   `json:"changed"`
+	Data    map[string]interface{} `json:"event_data"`
+}
+
+// Module returns the module run by the event's task, e.g.
+// "ansible.builtin.yum".
+func (e JobEvent) Module() string {
+	module, _ := e.Data["task_action"].(string)
+	return module
+}
+
+// Result returns the module result of a host event.
+func (e JobEvent) Result() map[string]interface{} {
+	res, _ := e.Data["res"].(map[string]interface{})
+	return res
+}
+
+// IgnoredError reports whether the event is a failure the playbook ignored
+// with ignore_errors.
+func (e JobEvent) IgnoredError() bool {
+	ignored, _ := e.Data["ignore_errors"].(bool)
+	return ignored
+}
+
+// HostSummary is the play recap of one host in a job.
+type HostSummary struct {
+	Host        string `json:"host_name"`
+	Ok          int    `json:"ok"`
+	Changed     int    `json:"changed"`
+	Unreachable int    `json:"dark"`
+	Failures    int    `json:"failures"`
+	Skipped     int    `json:"skipped"`
+	Rescued     int    `json:"rescued"`
+	Ignored     int    `json:"ignored"`
+	Failed      bool   `json:"failed"`
+}
+
+// PollOptions control how PollJob and PollWorkflowJob wait for a job.
+type PollOptions struct {
+	// Timeout bounds the job's whole lifecycle, QueueTimeout the time until
+	// it starts and RunTimeout the time it runs. Zero means no limit.
+	Timeout      time.Duration
+	QueueTimeout time.Duration
+	RunTimeout   time.Duration
+	PollInterval time.Duration
+	// OnQueue, if set, is called on every poll while the job waits to run.
+	OnQueue func(QueueInfo)
+	// OnEvent, if set, receives the job's events in counter order while the
+	// job runs. Every event is delivered exactly once.
+	OnEvent func(JobEvent)
+	// OnJob, if set, is called before the events of a workflow node's job
+	// are delivered.
+	OnJob func(jobID int, name string)
+	// Websocket makes PollJob follow the job over the controller's websocket
+	// instead of polling. If the socket cannot be used or drops, PollJob
+	// falls back to polling and reports the reason to OnFallback.
+	Websocket  bool
+	OnFallback func(error)
+}
+
+// JobOutcome is how a finished job ended.
+type JobOutcome string
+
+const (
+	OutcomeSuccessful JobOutcome = "successful"
+	// OutcomeFailed means the playbook ran and a task failed.
+	OutcomeFailed JobOutcome = "failed"
+	// OutcomeUnreachable means the playbook ran but every host that did not
+	// succeed was unreachable.
+	OutcomeUnreachable JobOutcome = "unreachable"
+	// OutcomeError means the controller could not run the job, e.g. because
+	// the project or the execution environment could not be prepared.
+	OutcomeError    JobOutcome = "error"
+	OutcomeCanceled JobOutcome = "canceled"
+)
+
+// Errors matched with errors.Is against the errors returned by PollJob and
+// PollWorkflowJob. A *JobFailedError matches the sentinel of its outcome.
+var (
+	ErrJobFailed        = errors.New("job failed")
+	ErrHostsUnreachable = errors.New("hosts unreachable")
+	ErrJobErrored       = errors.New("job ended in error")
+	ErrJobCanceled      = errors.New("job canceled")
+	ErrJobTimeout       = errors.New("timeout waiting for job completion")
+)
+
+// JobStatus is the state of a job or workflow job.
+type JobStatus struct {
+	ID          int    `json:"id"`
+	Status      string `json:"status"`
+	Failed      bool   `json:"failed"`
+	Explanation string `json:"job_explanation"`
+	// HostStatusCounts counts the job's hosts by their final status, e.g.
+	// "ok", "failures" and "dark" (unreachable).
+	HostStatusCounts map[string]int `json:"host_status_counts"`
+	Created          time.Time      `json:"created"`
+	SummaryFields    struct {
+		InstanceGroup struct {
+			Name string `json:"name"`
+		} `json:"instance_group"`
+	} `json:"summary_fields"`
+	// EventProcessingFinished reports whether the controller has saved all
+	// of a finished job's events. It is nil for controllers that do not
+	// report it.
+	EventProcessingFinished *bool `json:"event_processing_finished"`
+
+	Kind JobKind `json:"-"`
+}
+
+// Outcome returns how the job ended, or "" while it is new, pending,
+// waiting or running.
+func (s JobStatus) Outcome() JobOutcome {
+	switch s.Status {
+	case "successful":
+		return OutcomeSuccessful
+	case "error":
+		return OutcomeError
+	case "canceled":
+		return OutcomeCanceled
+	case "failed":
+	default:
+		if !s.Failed {
+			return ""
+		}
+	}
+	if s.HostStatusCounts["dark"] > 0 && s.HostStatusCounts["failures"] == 0 {
+		return OutcomeUnreachable
+	}
+	return OutcomeFailed
+}
+
+func (s JobStatus) finished() bool {
+	return s.Outcome() != ""
+}
+
+// eventsSaved reports whether all events of a finished job can be fetched.
+func (s JobStatus) eventsSaved() bool {
+	return s.EventProcessingFinished == nil || *s.EventProcessingFinished
+}
+
+// Err returns nil if the job succeeded and a *JobFailedError if it finished
+// otherwise.
+func (s JobStatus) Err() error {
+	outcome := s.Outcome()
+	if outcome == "" || outcome == OutcomeSuccessful {
+		return nil
+	}
+	return &JobFailedError{
+		JobID:       s.ID,
+		Outcome:     outcome,
+		Explanation: s.Explanation,
+		Unreachable: s.HostStatusCounts["dark"],
+		Kind:        s.Kind,
+	}
+}
+
+// JobFailedError is returned by PollJob, PollWorkflowJob, PollAdHocCommand
+// and PollProjectUpdate when a job finishes without succeeding.
+type JobFailedError struct {
+	JobID   int
+	Outcome JobOutcome
+	// Explanation is the controller's job_explanation, e.g. why a job
+	// ended in error or who canceled it.
+	Explanation string
+	// Unreachable is the number of unreachable hosts.
+	Unreachable int
+	Kind        JobKind
+}
+
+func (e *JobFailedError) Error() string {
+	job := e.Kind.name(e.JobID)
+
+	var msg string
+	switch e.Outcome {
+	case OutcomeUnreachable:
+		msg = fmt.Sprintf("%s failed: %d host(s) unreachable", job, e.Unreachable)
+	case OutcomeError:
+		msg = job + " ended in error"
+	case OutcomeCanceled:
+		msg = job + " was canceled"
+	default:
+		msg = job + " failed"
+	}
+	if e.Explanation != "" {
+		msg += ": " + e.Explanation
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error of the job's outcome.
+func (e *JobFailedError) Unwrap() error {
+	switch e.Outcome {
+	case OutcomeUnreachable:
+		return ErrHostsUnreachable
+	case OutcomeError:
+		return ErrJobErrored
+	case OutcomeCanceled:
+		return ErrJobCanceled
+	}
+	return ErrJobFailed
+}
+
+// JobKind is a kind of unified job, such as a playbook job or a project
+// update, and names its API resources.
+type JobKind struct {
+	// Name is how the kind is called in messages, e.g. "ad hoc command".
+	Name string
+	// path is the collection, e.g. "jobs".
+	path string
+	// events is the sub-resource listing the job's events.
+	events string
+	// group is the websocket group of the job's events.
+	group string
+}
+
+// The kinds of jobs the client waits for.
+var (
+	KindJob           = JobKind{Name: "job", path: "jobs", events: "job_events", group: "job_events"}
+	KindWorkflowJob   = JobKind{Name: "workflow job", path: "workflow_jobs"}
+	KindAdHocCommand  = JobKind{Name: "ad hoc command", path: "ad_hoc_commands", events: "events", group: "ad_hoc_command_events"}
+	KindProjectUpdate = JobKind{Name: "project update", path: "project_updates", events: "events", group: "project_update_events"}
+)
+
+// name names a job of this kind in error messages. The zero JobKind names
+// a playbook job.
+func (k JobKind) name(id int) string {
+	if k.Name == "" {
+		k = KindJob
+	}
+	return fmt.Sprintf("%s %d", k.Name, id)
+}
+
+// url returns the path of a job, or of one of its sub-resources.
+func (k JobKind) url(id int, sub string) string {
+	if sub == "" {
+		return fmt.Sprintf("/api/controller/v2/%s/%d/", k.path, id)
+	}
+	return fmt.Sprintf("/api/controller/v2/%s/%d/%s/", k.path, id, sub)
+}
+
+// GetJobEvents returns the events of a job with a counter above
+// afterCounter, in counter order.
+func (c *AAPClient) GetJobEvents(ctx context.Context, jobID, afterCounter int) ([]JobEvent, error) {
+	return c.eventsAfter(ctx, KindJob, jobID, afterCounter)
+}
+
+func (c *AAPClient) eventsAfter(ctx context.Context, kind JobKind, id, afterCounter int) ([]JobEvent, error) {
+	query := url.Values{
+		"order_by":    {"counter"},
+		"page_size":   {"200"},
+		"counter__gt": {fmt.Sprint(afterCounter)},
+	}
+	return c.getEvents(ctx, kind.url(id, kind.events)+"?"+query.Encode())
+}
+
+// getEvents fetches every page of a list of job events.
+func (c *AAPClient) getEvents(ctx context.Context, next string) ([]JobEvent, error) {
+	var events []JobEvent
+	for next != "" {
+		resp, err := c.client.R().SetContext(ctx).Get(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch job events: %w", err)
+		}
+		if resp.IsError() {
+			return nil, fmt.Errorf("failed to fetch job events: %w", newAPIError(resp))
+		}
+
+		var page struct {
+			Next    string     `json:"next"`
+			Results []JobEvent `json:"results"`
+		}
+		if err := json.Unmarshal(resp.Body(), &page); err != nil {
+			return nil, fmt.Errorf("failed to parse job events response: %w", err)
+		}
+		events = append(events, page.Results...)
+		next = page.Next
+	}
+	return events, nil
+}
+
+// GetFailedJobEvents returns the failed and unreachable host events of a
+// job, in counter order.
+func (c *AAPClient) GetFailedJobEvents(ctx context.Context, jobID int) ([]JobEvent, error) {
+	query := url.Values{
+		"order_by":  {"counter"},
+		"page_size": {"200"},
+		"event__in": {"runner_on_failed,runner_on_unreachable"},
+	}
+	return c.getEvents(ctx, KindJob.url(jobID, KindJob.events)+"?"+query.Encode())
+}
+
+// GetJobHostSummaries returns the play recap of every host in a job.
+func (c *AAPClient) GetJobHostSummaries(ctx context.Context, jobID int) ([]HostSummary, error) {
+	next := fmt.Sprintf("/api/controller/v2/jobs/%d/job_host_summaries/?order_by=host_name&page_size=200", jobID)
+
+	var summaries []HostSummary
+	for next != "" {
+		resp, err := c.client.R().SetContext(ctx).Get(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch job host summaries: %w", err)
+		}
+		if resp.IsError() {
+			return nil, fmt.Errorf("failed to fetch job host summaries: %w", newAPIError(resp))
+		}
+
+		var page struct {
+			Next    string        `json:"next"`
+			Results []HostSummary `json:"results"`
+		}
+		if err := json.Unmarshal(resp.Body(), &page); err != nil {
+			return nil, fmt.Errorf("failed to parse job host summaries response: %w", err)
+		}
+		summaries = append(summaries, page.Results...)
+		next = page.Next
+	}
+	return summaries, nil
+}
+
+// eventStream delivers the events of one job in counter order. The
+// controller saves events asynchronously, so an event may show up after
+// later ones; the stream holds events back until the gap is filled or the
+// job has finished.
+type eventStream struct {
+	client  *AAPClient
+	kind    JobKind
+	jobID   int
+	next    int
+	pending map[int]JobEvent
+}
+
+func newEventStream(c *AAPClient, kind JobKind, jobID int) *eventStream {
+	return &eventStream{client: c, kind: kind, jobID: jobID, next: 1, pending: make(map[int]JobEvent)}
+}
+
+// poll fetches new events and delivers those that are in order. With final
+// set, all remaining events are delivered regardless of gaps.
+func (s *eventStream) poll(ctx context.Context, final bool, emit func(JobEvent)) error {
+	events, err := s.client.eventsAfter(ctx, s.kind, s.jobID, s.next-1)
+	if err != nil {
+		return err
+	}
+	s.add(events...)
+	s.flush(final, emit)
+	return nil
+}
+
+// maxEventProcessingWait bounds how long a finished job's events are
+// waited for before the stream delivers what it has.
+const maxEventProcessingWait = 30 * time.Second
+
+// finish delivers the remaining events of a finished job. The controller
+// may still be saving events, the play recap included, when the job's status
+// turns final, so unless saved is set the stream keeps fetching events until
+// the job reports event_processing_finished.
+func (s *eventStream) finish(ctx context.Context, saved bool, interval time.Duration, emit func(JobEvent)) error {
+	if interval <= 0 || interval > time.Second {
+		interval = time.Second
+	}
+	deadline := time.Now().Add(maxEventProcessingWait)
+	for !saved && time.Now().Before(deadline) {
+		if err := s.poll(ctx, false, emit); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		status, err := s.client.getStatus(ctx, s.kind.url(s.jobID, ""), s.jobID)
+		if err != nil {
+			return err
+		}
+		saved = status.eventsSaved()
+	}
+	return s.poll(ctx, true, emit)
+}
+
+// add queues events for delivery. Events that were already delivered are
+// dropped.
+func (s *eventStream) add(events ...JobEvent) {
+	for _, e := range events {
+		if e.Counter >= s.next {
+			s.pending[e.Counter] = e
+		}
+	}
+}
+
+// flush delivers the queued events that are in order. With final set, all
+// queued events are delivered regardless of gaps.
+func (s *eventStream) flush(final bool, emit func(JobEvent)) {
+	for {
+		e, ok := s.pending[s.next]
+		if !ok {
+			break
+		}
+		delete(s.pending, s.next)
+		s.next++
+		emit(e)
+	}
+
+	if final && len(s.pending) > 0 {
+		counters := make([]int, 0, len(s.pending))
+		for counter := range s.pending {
+			counters = append(counters, counter)
+		}
+		sort.Ints(counters)
+		for _, counter := range counters {
+			emit(s.pending[counter])
+		}
+		s.next = counters[len(counters)-1] + 1
+		s.pending = make(map[int]JobEvent)
+	}
+}
+
+// getStatus fetches the status of a job or workflow job.
+func (c *AAPClient) getStatus(ctx context.Context, path string, id int) (JobStatus, error) {
+	var result JobStatus
+	resp, err := c.client.R().SetContext(ctx).Get(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to poll job %d: %w", id, err)
+	}
+	if resp.IsError() {
+		return result, fmt.Errorf("failed to poll job %d: %w", id, newAPIError(resp))
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return result, fmt.Errorf("failed to parse job %d status: %w", id, err)
+	}
+	result.ID = id
+	return result, nil
+}
+
+// PollJob waits for a job to finish, delivering its events to opts.OnEvent
+// as they arrive. It returns nil when the job succeeds.
+func (c *AAPClient) PollJob(ctx context.Context, jobID int, opts PollOptions) error {
+	return c.poll(ctx, KindJob, jobID, opts)
+}
+
+func (c *AAPClient) poll(ctx context.Context, kind JobKind, jobID int, opts PollOptions) error {
+	var stream *eventStream
+	if opts.OnEvent != nil {
+		stream = newEventStream(c, kind, jobID)
+	}
+
+	clock := newJobClock(jobID, opts, kind)
+	if opts.Websocket {
+		result, err := c.watchJob(ctx, kind, jobID, stream, opts, clock)
+		switch {
+		case err == nil:
+			// Pick up events that were saved before the subscription or
+			// after the job finished.
+			if stream != nil {
+				if err := stream.finish(ctx, result.eventsSaved(), opts.PollInterval, opts.OnEvent); err != nil {
+					return err
+				}
+			}
+			result.Kind = kind
+			return result.Err()
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, ErrJobTimeout):
+			return err
+		}
+		if opts.OnFallback != nil {
+			opts.OnFallback(err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.PollInterval):
+			result, err := c.getStatus(ctx, kind.url(jobID, ""), jobID)
+			if err != nil {
+				return err
+			}
+			clock.observe(result.Status)
+			if stream != nil {
+				if result.finished() {
+					err = stream.finish(ctx, result.eventsSaved(), opts.PollInterval, opts.OnEvent)
+				} else {
+					err = stream.poll(ctx, false, opts.OnEvent)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if result.finished() {
+				result.Kind = kind
+				return result.Err()
+			}
+			if queued(result.Status) && opts.OnQueue != nil {
+				opts.OnQueue(c.queueInfo(ctx, result))
+			}
+		}
+		if err := clock.expired(); err != nil {
+			return err
+		}
+	}
+}
+
+// workflowNode is a node of a running workflow job.
+type workflowNode struct {
+	Job           *int `json:"job"`
+	SummaryFields struct {
+		Job struct {
+			ID     int    `json:"id"`
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Type   string `json:"type"`
+			Failed bool   `json:"failed"`
+		} `json:"job"`
+	} `json:"summary_fields"`
+}
+
+func (c *AAPClient) getWorkflowNodes(ctx context.Context, workflowJobID int) ([]workflowNode, error) {
+	next := fmt.Sprintf("/api/controller/v2/workflow_jobs/%d/workflow_nodes/?page_size=200", workflowJobID)
+
+	var nodes []workflowNode
+	for next != "" {
+		resp, err := c.client.R().SetContext(ctx).Get(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch workflow nodes: %w", err)
+		}
+		if resp.IsError() {
+			return nil, fmt.Errorf("failed to fetch workflow nodes: %w", newAPIError(resp))
+		}
+
+		var page struct {
+			Next    string         `json:"next"`
+			Results []workflowNode `json:"results"`
+		}
+		if err := json.Unmarshal(resp.Body(), &page); err != nil {
+			return nil, fmt.Errorf("failed to parse workflow nodes response: %w", err)
+		}
+		nodes = append(nodes, page.Results...)
+		next = page.Next
+	}
+	return nodes, nil
+}
+
+// PollWorkflowJob waits for a workflow job to finish. With opts.OnEvent set,
+// the playbook jobs spawned by the workflow are streamed one at a time, in
+// the order they were launched.
+func (c *AAPClient) PollWorkflowJob(ctx context.Context, workflowJobID int, opts PollOptions) error {
+	type nodeJob struct {
+		id     int
+		name   string
+		stream *eventStream
+	}
+	var jobs []*nodeJob
+	known := make(map[int]bool)
+	current := 0
+
+	stream := func(final bool) error {
+		nodes, err := c.getWorkflowNodes(ctx, workflowJobID)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			job := node.SummaryFields.Job
+			if node.Job == nil || job.Type != "job" || known[job.ID] {
+				continue
+			}
+			known[job.ID] = true
+			jobs = append(jobs, &nodeJob{id: job.ID, name: job.Name})
+		}
+		sort.SliceStable(jobs[current:], func(i, j int) bool {
+			return jobs[current+i].id < jobs[current+j].id
+		})
+		statuses := make(map[int]JobStatus, len(nodes))
+		for _, node := range nodes {
+			job := node.SummaryFields.Job
+			statuses[job.ID] = JobStatus{ID: job.ID, Status: job.Status, Failed: job.Failed}
+		}
+
+		for current < len(jobs) {
+			job := jobs[current]
+			if job.stream == nil {
+				job.stream = newEventStream(c, KindJob, job.id)
+				if opts.OnJob != nil {
+					opts.OnJob(job.id, job.name)
+				}
+			}
+			if !final && !statuses[job.id].finished() {
+				if err := job.stream.poll(ctx, false, opts.OnEvent); err != nil {
+					return err
+				}
+				break
+			}
+			// Node summaries do not say whether the job's events are saved.
+			if err := job.stream.finish(ctx, false, opts.PollInterval, opts.OnEvent); err != nil {
+				return err
+			}
+			current++
+		}
+		return nil
+	}
+
+	clock := newJobClock(workflowJobID, opts, KindWorkflowJob)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.PollInterval):
+			result, err := c.getStatus(ctx, KindWorkflowJob.url(workflowJobID, ""), workflowJobID)
+			if err != nil {
+				return err
+			}
+			clock.observe(result.Status)
+			if opts.OnEvent != nil {
+				if err := stream(result.finished()); err != nil {
+					return err
+				}
+			}
+			if result.finished() {
+				result.Kind = KindWorkflowJob
+				return result.Err()
+			}
+			if queued(result.Status) && opts.OnQueue != nil {
+				opts.OnQueue(QueueInfo{Status: result.Status})
+			}
+		}
+		if err := clock.expired(); err != nil {
+			return err
+		}
+	}
+}
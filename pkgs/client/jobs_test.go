@@ -0,0 +1,455 @@
+package client_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
+)
+
+func newJobsTestClient(url string) *client.AAPClient {
+	return client.NewAAPClient(config.Config{
+		TowerHost:          url,
+		Username:           "admin",
+		Password:           "secret",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+}
+
+// writeEvents answers a job_events request with the events above the
+// requested counter, split into pages of two.
+func writeEvents(t *testing.T, w http.ResponseWriter, r *http.Request, available []int) {
+	after, _ := strconv.Atoi(r.URL.Query().Get("counter__gt"))
+	var results []map[string]interface{}
+	for _, counter := range available {
+		if counter > after {
+			results = append(results, map[string]interface{}{
+				"counter": counter,
+				"event":   "runner_on_ok",
+				"stdout":  fmt.Sprintf("line %d", counter),
+			})
+		}
+	}
+
+	page := map[string]interface{}{"results": results, "next": nil}
+	if r.URL.Query().Get("page") == "" && len(results) > 2 {
+		page["results"] = results[:2]
+		page["next"] = r.URL.Path + "?" + r.URL.RawQuery + "&page=2"
+	} else if r.URL.Query().Get("page") == "2" {
+		page["results"] = results[2:]
+	}
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		t.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+func TestAAPClient_PollJob_StreamsEventsOnce(t *testing.T) {
+	// Events are saved out of order: counter 2 shows up a poll after 3, and
+	// counter 6 never fills the gap before 7.
+	visible := [][]int{
+		{1, 3},
+		{1, 2, 3, 4, 5},
+		{1, 2, 3, 4, 5, 7},
+	}
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/controller/v2/jobs/999/":
+			polls++
+			status := "running"
+			if polls >= len(visible) {
+				status = "successful"
+			}
+			_, _ = fmt.Fprintf(w, `{"status": %q}`, status)
+		case "/api/controller/v2/jobs/999/job_events/":
+			writeEvents(t, w, r, visible[min(polls, len(visible))-1])
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var got []int
+	err := newJobsTestClient(server.URL).PollJob(t.Context(), 999, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+		OnEvent: func(e client.JobEvent) {
+			got = append(got, e.Counter)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []int{1, 2, 3, 4, 5, 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
+
+func TestAAPClient_PollJob_WaitsForEventProcessing(t *testing.T) {
+	// The job finishes before its last events, the play recap included,
+	// are saved.
+	visible := [][]int{
+		{1, 2},
+		{1, 2},
+		{1, 2, 3, 5},
+		{1, 2, 3, 4, 5, 6},
+	}
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/controller/v2/jobs/999/":
+			polls++
+			_, _ = fmt.Fprintf(w, `{"status": "successful", "event_processing_finished": %t}`, polls >= len(visible))
+		case "/api/controller/v2/jobs/999/job_events/":
+			writeEvents(t, w, r, visible[min(polls, len(visible))-1])
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var got []int
+	err := newJobsTestClient(server.URL).PollJob(t.Context(), 999, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+		OnEvent: func(e client.JobEvent) {
+			got = append(got, e.Counter)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []int{1, 2, 3, 4, 5, 6}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
+
+func TestAAPClient_LaunchJob_WorkflowJobID(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/controller/v2/workflow_job_templates/84/launch/" {
+			t.Errorf("Expected workflow launch, got %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"workflow_job": 321, "id": 321, "type": "workflow_job"}`))
+	}))
+	defer server.Close()
+
+	jobID, err := newJobsTestClient(server.URL).LaunchJob(t.Context(), 123, 0, 84, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if jobID != 321 {
+		t.Errorf("Expected workflow job ID 321, got %d", jobID)
+	}
+}
+
+func TestAAPClient_RelaunchJob(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/controller/v2/jobs/999/relaunch/" {
+			t.Errorf("Expected POST to job 999 relaunch, got %s %s", r.Method, r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if body["hosts"] != "failed" {
+			t.Errorf("Expected hosts=failed, got %v", body["hosts"])
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"job": 1000, "id": 1000, "type": "job"}`))
+	}))
+	defer server.Close()
+
+	jobID, err := newJobsTestClient(server.URL).RelaunchJob(t.Context(), 999, "failed")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if jobID != 1000 {
+		t.Errorf("Expected relaunched job ID 1000, got %d", jobID)
+	}
+}
+
+func TestAAPClient_PollWorkflowJob_StreamsNodesInTurn(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/controller/v2/workflow_jobs/50/":
+			polls++
+			status := "running"
+			if polls >= 3 {
+				status = "successful"
+			}
+			_, _ = fmt.Fprintf(w, `{"status": %q}`, status)
+		case "/api/controller/v2/workflow_jobs/50/workflow_nodes/":
+			second := "running"
+			if polls >= 2 {
+				second = "successful"
+			}
+			_, _ = fmt.Fprintf(w, `{"next": null, "results": [
+				{"job": 62, "summary_fields": {"job": {"id": 62, "name": "configure", "status": %q, "type": "job"}}},
+				{"job": 61, "summary_fields": {"job": {"id": 61, "name": "base", "status": "successful", "type": "job"}}},
+				{"job": 63, "summary_fields": {"job": {"id": 63, "name": "approve", "status": "successful", "type": "workflow_approval"}}},
+				{"job": null, "summary_fields": {}}
+			]}`, second)
+		case "/api/controller/v2/jobs/61/", "/api/controller/v2/jobs/62/":
+			_, _ = w.Write([]byte(`{"status": "successful", "event_processing_finished": true}`))
+		case "/api/controller/v2/jobs/61/job_events/":
+			writeEvents(t, w, r, []int{1, 2})
+		case "/api/controller/v2/jobs/62/job_events/":
+			if polls >= 2 {
+				writeEvents(t, w, r, []int{1, 2, 3})
+			} else {
+				writeEvents(t, w, r, []int{1})
+			}
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var got []string
+	err := newJobsTestClient(server.URL).PollWorkflowJob(t.Context(), 50, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+		OnJob: func(jobID int, name string) {
+			got = append(got, fmt.Sprintf("job %d %s", jobID, name))
+		},
+		OnEvent: func(e client.JobEvent) {
+			got = append(got, e.Stdout)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []string{
+		"job 61 base", "line 1", "line 2",
+		"job 62 configure", "line 1", "line 2", "line 3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected output %v, got %v", want, got)
+	}
+}
+
+func TestAAPClient_JobFailureDetails(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/controller/v2/jobs/999/job_host_summaries/":
+			_, _ = w.Write([]byte(`{"next": null, "results": [
+				{"host_name": "10.0.0.5", "ok": 3, "changed": 1, "dark": 0, "failures": 1, "skipped": 2, "failed": true}
+			]}`))
+		case "/api/controller/v2/jobs/999/job_events/":
+			if got := r.URL.Query().Get("event__in"); got != "runner_on_failed,runner_on_unreachable" {
+				t.Errorf("Expected failed and unreachable events to be requested, got %q", got)
+			}
+			_, _ = w.Write([]byte(`{"next": null, "results": [
+				{"counter": 7, "event": "runner_on_failed", "host_name": "10.0.0.5", "task": "Install nginx", "role": "webserver",
+				 "event_data": {"task_action": "ansible.builtin.dnf", "ignore_errors": false, "res": {"msg": "No package nginx available."}}}
+			]}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	c := newJobsTestClient(server.URL)
+
+	summaries, err := c.GetJobHostSummaries(t.Context(), 999)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []client.HostSummary{{Host: "10.0.0.5", Ok: 3, Changed: 1, Failures: 1, Skipped: 2, Failed: true}}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("Expected summaries %+v, got %+v", want, summaries)
+	}
+
+	events, err := c.GetFailedJobEvents(t.Context(), 999)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected one failed event, got %d", len(events))
+	}
+	e := events[0]
+	if e.Module() != "ansible.builtin.dnf" || e.Role != "webserver" || e.IgnoredError() {
+		t.Errorf("Expected dnf task of role webserver, got module %q, role %q", e.Module(), e.Role)
+	}
+	if e.Result()["msg"] != "No package nginx available." {
+		t.Errorf("Expected result msg, got %v", e.Result())
+	}
+}
+
+func TestAAPClient_PollJob_Outcomes(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name:   "successful",
+			status: `{"status": "successful"}`,
+		},
+		{
+			name:    "failed",
+			status:  `{"status": "failed", "failed": true, "host_status_counts": {"failures": 1, "dark": 1}}`,
+			wantErr: client.ErrJobFailed,
+			wantMsg: "job 999 failed",
+		},
+		{
+			name:    "unreachable",
+			status:  `{"status": "failed", "failed": true, "host_status_counts": {"ok": 1, "dark": 2}}`,
+			wantErr: client.ErrHostsUnreachable,
+			wantMsg: "job 999 failed: 2 host(s) unreachable",
+		},
+		{
+			name:    "error",
+			status:  `{"status": "error", "failed": true, "job_explanation": "Failed to update project"}`,
+			wantErr: client.ErrJobErrored,
+			wantMsg: "job 999 ended in error: Failed to update project",
+		},
+		{
+			name:    "canceled",
+			status:  `{"status": "canceled", "job_explanation": "Canceled by admin"}`,
+			wantErr: client.ErrJobCanceled,
+			wantMsg: "job 999 was canceled: Canceled by admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tt.status))
+			}))
+			defer server.Close()
+
+			err := newJobsTestClient(server.URL).PollJob(t.Context(), 999, client.PollOptions{
+				Timeout:      30 * time.Second,
+				PollInterval: time.Millisecond,
+			})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("Expected message %q, got %q", tt.wantMsg, err.Error())
+			}
+			for _, other := range []error{client.ErrJobFailed, client.ErrHostsUnreachable, client.ErrJobErrored, client.ErrJobCanceled, client.ErrJobTimeout} {
+				if other != tt.wantErr && errors.Is(err, other) {
+					t.Errorf("Expected error not to match %v", other)
+				}
+			}
+		})
+	}
+}
+
+func TestAAPClient_PollJob_QueueAndRunTimeouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    string
+		opts      client.PollOptions
+		wantErr   error
+		wantMsg   string
+		wantQueue *client.QueueInfo
+	}{
+		{
+			name:      "stuck in queue",
+			status:    `{"status": "pending", "created": "2026-01-02T03:04:05.123456Z"}`,
+			opts:      client.PollOptions{QueueTimeout: 50 * time.Millisecond, RunTimeout: time.Hour},
+			wantErr:   client.ErrJobQueueTimeout,
+			wantMsg:   "job 999 did not start within 50ms (still pending)",
+			wantQueue: &client.QueueInfo{Status: "pending", Position: 3},
+		},
+		{
+			name:      "waiting on an instance group",
+			status:    `{"status": "waiting", "summary_fields": {"instance_group": {"id": 2, "name": "default"}}}`,
+			opts:      client.PollOptions{QueueTimeout: 50 * time.Millisecond},
+			wantErr:   client.ErrJobQueueTimeout,
+			wantMsg:   "(still waiting)",
+			wantQueue: &client.QueueInfo{Status: "waiting", InstanceGroup: "default"},
+		},
+		{
+			name:    "runs too long",
+			status:  `{"status": "running"}`,
+			opts:    client.PollOptions{QueueTimeout: time.Hour, RunTimeout: 50 * time.Millisecond},
+			wantErr: client.ErrJobRunTimeout,
+			wantMsg: "job 999 did not finish within 50ms of starting",
+		},
+		{
+			name:    "overall timeout while running",
+			status:  `{"status": "running"}`,
+			opts:    client.PollOptions{Timeout: 50 * time.Millisecond, RunTimeout: 50 * time.Millisecond},
+			wantErr: client.ErrJobRunTimeout,
+			wantMsg: "job 999 did not finish within 50ms of launch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/controller/v2/jobs/999/":
+					_, _ = w.Write([]byte(tt.status))
+				case "/api/controller/v2/unified_jobs/":
+					if r.URL.Query().Get("created__lt") != "2026-01-02T03:04:05.123456Z" {
+						t.Errorf("Expected jobs created before ours to be counted, got %s", r.URL.RawQuery)
+					}
+					_, _ = w.Write([]byte(`{"count": 2, "results": []}`))
+				default:
+					t.Errorf("Unexpected request %s", r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			var queue *client.QueueInfo
+			opts := tt.opts
+			opts.PollInterval = 10 * time.Millisecond
+			opts.OnQueue = func(info client.QueueInfo) {
+				queue = &info
+			}
+			err := newJobsTestClient(server.URL).PollJob(t.Context(), 999, opts)
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, client.ErrJobTimeout) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Expected error to contain %q, got %q", tt.wantMsg, err.Error())
+			}
+			if !reflect.DeepEqual(queue, tt.wantQueue) {
+				t.Errorf("Expected queue info %+v, got %+v", tt.wantQueue, queue)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Project is a project's SCM source and the revision it last synced.
+type Project struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	ScmType     string `json:"scm_type"`
+	ScmURL      string `json:"scm_url"`
+	ScmBranch   string `json:"scm_branch"`
+	ScmRevision string `json:"scm_revision"`
+}
+
+// ProjectUpdate is a single sync of a project and the revision it checked
+// out, which the project reports only until the next update.
+type ProjectUpdate struct {
+	ID          int    `json:"id"`
+	ScmBranch   string `json:"scm_branch"`
+	ScmRevision string `json:"scm_revision"`
+}
+
+func (c *AAPClient) GetProject(ctx context.Context, projectID int) (Project, error) {
+	var project Project
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(fmt.Sprintf("/api/controller/v2/projects/%d/", projectID))
+	if err != nil {
+		return project, fmt.Errorf("failed to fetch project %d: %w", projectID, err)
+	}
+	if resp.IsError() {
+		return project, fmt.Errorf("failed to fetch project %d: %w", projectID, newAPIError(resp))
+	}
+	if err := json.Unmarshal(resp.Body(), &project); err != nil {
+		return project, fmt.Errorf("failed to parse project %d: %w", projectID, err)
+	}
+	return project, nil
+}
+
+// GetJobTemplateProject returns the ID of the project a job template runs
+// its playbook from.
+func (c *AAPClient) GetJobTemplateProject(ctx context.Context, jobTemplateID int) (int, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(fmt.Sprintf("/api/controller/v2/job_templates/%d/", jobTemplateID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch job template %d: %w", jobTemplateID, err)
+	}
+	if resp.IsError() {
+		return 0, fmt.Errorf("failed to fetch job template %d: %w", jobTemplateID, newAPIError(resp))
+	}
+
+	var result struct {
+		Project int `json:"project"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse job template %d: %w", jobTemplateID, err)
+	}
+	if result.Project == 0 {
+		return 0, fmt.Errorf("job template %d has no project", jobTemplateID)
+	}
+	return result.Project, nil
+}
+
+// UpdateProject starts a sync of a project from SCM and returns the ID of
+// the project update.
+func (c *AAPClient) UpdateProject(ctx context.Context, projectID int) (int, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Post(fmt.Sprintf("/api/controller/v2/projects/%d/update/", projectID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update project %d: %w", projectID, err)
+	}
+	if resp.IsError() {
+		return 0, fmt.Errorf("failed to update project %d: %w", projectID, newAPIError(resp))
+	}
+
+	var result struct {
+		ProjectUpdate int `json:"project_update"`
+		ID            int `json:"id"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse project update response: %w", err)
+	}
+	switch {
+	case result.ProjectUpdate != 0:
+		return result.ProjectUpdate, nil
+	case result.ID != 0:
+		return result.ID, nil
+	}
+	return 0, errors.New("project update response did not include an ID")
+}
+
+// PollProjectUpdate waits for a project update to finish like PollJob.
+func (c *AAPClient) PollProjectUpdate(ctx context.Context, updateID int, opts PollOptions) error {
+	return c.poll(ctx, KindProjectUpdate, updateID, opts)
+}
+
+// GetProjectUpdate returns a project update with the revision it synced.
+func (c *AAPClient) GetProjectUpdate(ctx context.Context, updateID int) (ProjectUpdate, error) {
+	var update ProjectUpdate
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get(KindProjectUpdate.url(updateID, ""))
+	if err != nil {
+		return update, fmt.Errorf("failed to fetch project update %d: %w", updateID, err)
+	}
+	if resp.IsError() {
+		return update, fmt.Errorf("failed to fetch project update %d: %w", updateID, newAPIError(resp))
+	}
+	if err := json.Unmarshal(resp.Body(), &update); err != nil {
+		return update, fmt.Errorf("failed to parse project update %d: %w", updateID, err)
+	}
+	return update, nil
+}
+
+// GetProjectUpdateStdout returns the output of a project update.
+func (c *AAPClient) GetProjectUpdateStdout(ctx context.Context, updateID int) (string, error) {
+	return c.stdout(ctx, KindProjectUpdate, updateID)
+}
@@ -0,0 +1,111 @@
+package client_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+func TestAAPClient_UpdateProject(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/controller/v2/job_templates/42/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 42, "project": 9}`))
+	})
+	mux.HandleFunc("/api/controller/v2/projects/9/update/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected POST, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"project_update": 77, "id": 77}`))
+	})
+	mux.HandleFunc("/api/controller/v2/project_updates/77/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 77, "status": "successful", "scm_branch": "main", "scm_revision": "3f2c1e9"}`))
+	})
+	mux.HandleFunc("/api/controller/v2/project_updates/77/events/", func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w, r, nil)
+	})
+	mux.HandleFunc("/api/controller/v2/projects/9/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 9, "name": "playbooks", "scm_type": "git", "scm_branch": "main", "scm_revision": "3f2c1e9"}`))
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	c := newJobsTestClient(server.URL)
+	projectID, err := c.GetJobTemplateProject(t.Context(), 42)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if projectID != 9 {
+		t.Fatalf("Expected project ID 9, got %d", projectID)
+	}
+	updateID, err := c.UpdateProject(t.Context(), projectID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updateID != 77 {
+		t.Fatalf("Expected project update ID 77, got %d", updateID)
+	}
+	err = c.PollProjectUpdate(t.Context(), updateID, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	update, err := c.GetProjectUpdate(t.Context(), updateID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	wantUpdate := client.ProjectUpdate{ID: 77, ScmBranch: "main", ScmRevision: "3f2c1e9"}
+	if update != wantUpdate {
+		t.Errorf("Expected project update %+v, got %+v", wantUpdate, update)
+	}
+
+	project, err := c.GetProject(t.Context(), projectID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := client.Project{ID: 9, Name: "playbooks", ScmType: "git", ScmBranch: "main", ScmRevision: "3f2c1e9"}
+	if project != want {
+		t.Errorf("Expected project %+v, got %+v", want, project)
+	}
+}
+
+func TestAAPClient_ProjectUpdateFailure(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/controller/v2/project_updates/77/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 77, "status": "failed"}`))
+	})
+	mux.HandleFunc("/api/controller/v2/project_updates/77/events/", func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w, r, nil)
+	})
+	mux.HandleFunc("/api/controller/v2/project_updates/77/stdout/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fatal: could not read from remote repository"))
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	c := newJobsTestClient(server.URL)
+	err := c.PollProjectUpdate(t.Context(), 77, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+	})
+	if !errors.Is(err, client.ErrJobFailed) {
+		t.Fatalf("Expected %v, got %v", client.ErrJobFailed, err)
+	}
+	if err.Error() != "project update 77 failed" {
+		t.Errorf("Expected message %q, got %q", "project update 77 failed", err.Error())
+	}
+	stdout, err := c.GetProjectUpdateStdout(t.Context(), 77)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stdout != "fatal: could not read from remote repository" {
+		t.Errorf("Expected the project update stdout, got %q", stdout)
+	}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/internal/jobclock"
+)
+
+// Errors matched with errors.Is against a *JobTimeoutError, in addition to
+// ErrJobTimeout.
+var (
+	ErrJobQueueTimeout = errors.New("job did not start in time")
+	ErrJobRunTimeout   = errors.New("job did not finish in time")
+)
+
+// JobTimeoutError is returned by PollJob, PollWorkflowJob, PollAdHocCommand
+// and PollProjectUpdate when a job stays queued longer than the queue
+// timeout, runs longer than the run timeout or takes longer than the overall
+// timeout.
+type JobTimeoutError struct {
+	JobID int
+	// Started reports whether the job left the queue.
+	Started bool
+	// Status is the job's last known status.
+	Status string
+	// Limit is the timeout that expired.
+	Limit time.Duration
+	// Overall reports whether Limit is the overall timeout, which counts
+	// the time spent in the queue.
+	Overall bool
+	Kind    JobKind
+}
+
+func (e *JobTimeoutError) Error() string {
+	job := e.Kind.name(e.JobID)
+	switch {
+	case !e.Started:
+		return fmt.Sprintf("%s did not start within %s (still %s)", job, e.Limit, e.Status)
+	case e.Overall:
+		return fmt.Sprintf("%s did not finish within %s of launch", job, e.Limit)
+	}
+	return fmt.Sprintf("%s did not finish within %s of starting", job, e.Limit)
+}
+
+// Unwrap matches ErrJobTimeout and either ErrJobQueueTimeout or
+// ErrJobRunTimeout.
+func (e *JobTimeoutError) Unwrap() []error {
+	if !e.Started {
+		return []error{ErrJobTimeout, ErrJobQueueTimeout}
+	}
+	return []error{ErrJobTimeout, ErrJobRunTimeout}
+}
+
+// QueueInfo describes a job that is waiting to run.
+type QueueInfo struct {
+	// Status is "new", "pending" or "waiting".
+	Status string
+	// Position is the job's 1-based position among pending jobs, or 0 if
+	// unknown.
+	Position int
+	// InstanceGroup is the instance group the job was assigned to, or ""
+	// while the controller is still looking for capacity.
+	InstanceGroup string
+}
+
+// queued reports whether a job status means the job has not started yet.
+func queued(status string) bool {
+	return jobclock.Queued(status)
+}
+
+// jobClock times a job against the timeouts of PollOptions and reports an
+// expired timeout as a *JobTimeoutError.
+type jobClock struct {
+	clock *jobclock.Clock
+	jobID int
+	kind  JobKind
+}
+
+func newJobClock(jobID int, opts PollOptions, kind JobKind) *jobClock {
+	limits := jobclock.Limits{Overall: opts.Timeout, Queue: opts.QueueTimeout, Run: opts.RunTimeout}
+	return &jobClock{clock: jobclock.New(limits), jobID: jobID, kind: kind}
+}
+
+// observe records the job's latest status.
+func (k *jobClock) observe(status string) {
+	k.clock.Observe(status)
+}
+
+// deadline returns when the job times out in its current phase, or the zero
+// time if no timeout applies.
+func (k *jobClock) deadline() time.Time {
+	return k.clock.Deadline()
+}
+
+// expired returns a *JobTimeoutError once the deadline has passed.
+func (k *jobClock) expired() error {
+	e, ok := k.clock.Expired()
+	if !ok {
+		return nil
+	}
+	return &JobTimeoutError{
+		JobID:   k.jobID,
+		Started: e.Started,
+		Status:  e.Status,
+		Limit:   e.Limit,
+		Overall: e.Overall,
+		Kind:    k.kind,
+	}
+}
+
+// queueInfo describes a queued job. The queue position is looked up on a
+// best-effort basis.
+func (c *AAPClient) queueInfo(ctx context.Context, result JobStatus) QueueInfo {
+	info := QueueInfo{
+		Status:        result.Status,
+		InstanceGroup: result.SummaryFields.InstanceGroup.Name,
+	}
+	if result.Status != "pending" || result.Created.IsZero() {
+		return info
+	}
+
+	query := url.Values{
+		"status":      {"pending"},
+		"created__lt": {result.Created.Format(time.RFC3339Nano)},
+		"page_size":   {"1"},
+	}
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Get("/api/controller/v2/unified_jobs/?" + query.Encode())
+	if err != nil || resp.IsError() {
+		return info
+	}
+	var page struct {
+		Count int `json:"count"`
+	}
+	if err := json.Unmarshal(resp.Body(), &page); err == nil {
+		info.Position = page.Count + 1
+	}
+	return info
+}
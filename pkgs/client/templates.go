@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// JobTemplate describes a temporary job template that runs a playbook of a
+// project. Every prompt on launch is enabled, so the launch can set the
+// inventory, credentials and extra vars like for any other template.
+type JobTemplate struct {
+	InventoryID int
+	ProjectID   int
+	Playbook    string
+	// ExecutionEnvironmentID is 0 to use the project's or organization's
+	// default.
+	ExecutionEnvironmentID int
+	// Timeout cancels jobs of the template that run longer. 0 means no
+	// limit.
+	Timeout time.Duration
+}
+
+// askOnLaunch lists the prompts enabled on temporary job templates. The SCM
+// branch is left out, since the controller rejects it for projects that do
+// not allow branch overrides.
+var askOnLaunch = []string{
+	"ask_inventory_on_launch",
+	"ask_credential_on_launch",
+	"ask_variables_on_launch",
+	"ask_limit_on_launch",
+	"ask_tags_on_launch",
+	"ask_skip_tags_on_launch",
+	"ask_job_type_on_launch",
+	"ask_verbosity_on_launch",
+	"ask_diff_mode_on_launch",
+	"ask_execution_environment_on_launch",
+	"ask_labels_on_launch",
+	"ask_forks_on_launch",
+	"ask_job_slice_count_on_launch",
+	"ask_timeout_on_launch",
+	"ask_instance_groups_on_launch",
+}
+
+// FindProject returns the ID of the project with the given name.
+func (c *AAPClient) FindProject(ctx context.Context, name string) (int, error) {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetQueryParamsFromValues(url.Values{"name": {name}}).
+		Get("/api/controller/v2/projects/")
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up project %q: %w", name, err)
+	}
+	if resp.IsError() {
+		return 0, fmt.Errorf("failed to look up project %q: %w", name, newAPIError(resp))
+	}
+
+	var result struct {
+		Results []struct {
+			ID int `json:"id"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("failed to parse projects response: %w", err)
+	}
+
+	switch len(result.Results) {
+	case 0:
+		return 0, fmt.Errorf("project %q not found", name)
+	case 1:
+		return result.Results[0].ID, nil
+	default:
+		return 0, fmt.Errorf("project name %q is ambiguous (%d matches), use project_id instead", name, len(result.Results))
+	}
+}
+
+// CreateJobTemplate creates a temporary job template tagged with the run
+// marker and returns its ID.
+func (c *AAPClient) CreateJobTemplate(ctx context.Context, tmpl JobTemplate) (int, error) {
+	name := c.resourceName("packer-jt")
+	body := map[string]interface{}{
+		"name":        name,
+		"description": c.description("Temporary job template for Packer build"),
+		"job_type":    "run",
+		"inventory":   tmpl.InventoryID,
+		"project":     tmpl.ProjectID,
+		"playbook":    tmpl.Playbook,
+		"timeout":     int(tmpl.Timeout.Seconds()),
+	}
+	if tmpl.ExecutionEnvironmentID != 0 {
+		body["execution_environment"] = tmpl.ExecutionEnvironmentID
+	}
+	for _, field := range askOnLaunch {
+		body[field] = true
+	}
+
+	return c.createResource(ctx, "job template", "/api/controller/v2/job_templates/", body, url.Values{
+		"name": {name},
+	})
+}
+
+// AddJobTemplateInstanceGroup appends an instance group to the instance
+// groups a job template runs on.
+func (c *AAPClient) AddJobTemplateInstanceGroup(ctx context.Context, jobTemplateID, instanceGroupID int) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(map[string]interface{}{"id": instanceGroupID}).
+		Post(fmt.Sprintf("/api/controller/v2/job_templates/%d/instance_groups/", jobTemplateID))
+
+	if err != nil {
+		return fmt.Errorf("failed to add instance group to job template: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to add instance group to job template: %w", newAPIError(resp))
+	}
+	return nil
+}
+
+func (c *AAPClient) DeleteJobTemplate(ctx context.Context, jobTemplateID int) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		Delete(fmt.Sprintf("/api/controller/v2/job_templates/%d/", jobTemplateID))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete job template: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to delete job template: %w", newAPIError(resp))
+	}
+	return nil
+}
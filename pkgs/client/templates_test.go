@@ -0,0 +1,79 @@
+package client_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+func TestAAPClient_CreateJobTemplate(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/controller/v2/job_templates/" {
+			t.Errorf("Expected POST to job templates, got %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 77}`))
+	}))
+	defer server.Close()
+
+	c := newJobsTestClient(server.URL)
+	templateID, err := c.CreateJobTemplate(t.Context(), client.JobTemplate{
+		InventoryID:            123,
+		ProjectID:              9,
+		Playbook:               "site.yml",
+		ExecutionEnvironmentID: 4,
+		Timeout:                30 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if templateID != 77 {
+		t.Errorf("Expected job template ID 77, got %d", templateID)
+	}
+
+	want := map[string]interface{}{
+		"name":                     "packer-jt-" + c.RunMarker(),
+		"inventory":                float64(123),
+		"project":                  float64(9),
+		"playbook":                 "site.yml",
+		"execution_environment":    float64(4),
+		"timeout":                  float64(1800),
+		"ask_inventory_on_launch":  true,
+		"ask_credential_on_launch": true,
+		"ask_variables_on_launch":  true,
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, body[key])
+		}
+	}
+	if _, ok := body["ask_scm_branch_on_launch"]; ok {
+		t.Error("Expected the SCM branch prompt to be left alone")
+	}
+}
+
+func TestAAPClient_FindProject(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("name"); got != "playbooks" {
+			t.Errorf("Expected lookup by name playbooks, got %q", got)
+		}
+		_, _ = w.Write([]byte(`{"count": 1, "results": [{"id": 9, "name": "playbooks"}]}`))
+	}))
+	defer server.Close()
+
+	projectID, err := newJobsTestClient(server.URL).FindProject(t.Context(), "playbooks")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if projectID != 9 {
+		t.Errorf("Expected project ID 9, got %d", projectID)
+	}
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// websocketPath is where the controller serves its websocket, and
+// loginPath where it starts the session the websocket requires.
+const (
+	websocketPath = "/api/controller/websocket/"
+	loginPath     = "/api/controller/login/"
+)
+
+// socketMessage is the envelope of a websocket message. Job status messages
+// carry the job's ID and status; job event messages are job events.
+type socketMessage struct {
+	GroupName    string `json:"group_name"`
+	UnifiedJobID int    `json:"unified_job_id"`
+	Status       string `json:"status"`
+	Error        string `json:"error"`
+}
+
+// sessionCookies returns the controller's CSRF token and whether the
+// websocket session holds a session cookie.
+func (c *AAPClient) sessionCookies(base *url.URL) (csrfToken string, session bool) {
+	jar := c.session.GetClient().Jar
+	if jar == nil {
+		return "", false
+	}
+	for _, cookie := range jar.Cookies(base) {
+		switch {
+		case cookie.Name == "csrftoken":
+			csrfToken = cookie.Value
+		case strings.HasSuffix(cookie.Name, "sessionid"):
+			session = true
+		}
+	}
+	return csrfToken, session
+}
+
+// login starts a session like the controller's login form does. The
+// controller only accepts websocket subscriptions from a logged in session
+// whose csrftoken cookie is sent back as xrftoken, which Basic and Bearer
+// authentication do not provide. The session is kept apart from the REST
+// client and is only used to dial the websocket.
+func (c *AAPClient) login(ctx context.Context, base *url.URL) error {
+	if _, session := c.sessionCookies(base); session {
+		return nil
+	}
+	if c.username == "" {
+		return errors.New("the websocket requires a session login, which needs username and password instead of access_token")
+	}
+
+	// Fetching the form sets the CSRF token the login must carry.
+	resp, err := c.session.R().SetContext(ctx).Get(loginPath)
+	if err != nil {
+		return fmt.Errorf("failed to start websocket session: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to start websocket session: %w", newAPIError(resp))
+	}
+	csrfToken, _ := c.sessionCookies(base)
+	if csrfToken == "" {
+		return errors.New("failed to start websocket session: the controller did not set a csrftoken cookie")
+	}
+
+	resp, err = c.session.R().
+		SetContext(ctx).
+		SetHeader("X-CSRFToken", csrfToken).
+		SetHeader("Referer", base.String()+loginPath).
+		SetFormData(map[string]string{
+			"username": c.username,
+			"password": c.password,
+			"next":     "/api/controller/v2/",
+		}).
+		Post(loginPath)
+	if err != nil {
+		return fmt.Errorf("failed to start websocket session: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("failed to start websocket session: %w", newAPIError(resp))
+	}
+	// A rejected login renders the form again instead of failing.
+	if _, session := c.sessionCookies(base); !session {
+		return errors.New("failed to start websocket session: the controller did not accept the login")
+	}
+	return nil
+}
+
+// dialWebsocket connects to the controller's websocket with the client's
+// credentials and TLS settings.
+func (c *AAPClient) dialWebsocket(ctx context.Context) (*websocket.Conn, *url.URL, error) {
+	base, err := url.Parse(c.client.BaseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid tower_host: %w", err)
+	}
+	if err := c.login(ctx, base); err != nil {
+		return nil, nil, err
+	}
+	location := *base
+	location.Path = strings.TrimSuffix(base.Path, "/") + websocketPath
+	switch base.Scheme {
+	case "https":
+		location.Scheme = "wss"
+	case "http":
+		location.Scheme = "ws"
+	}
+
+	cfg, err := websocket.NewConfig(location.String(), base.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid websocket address: %w", err)
+	}
+	cfg.TlsConfig = c.tlsConfig
+	cfg.Header.Set("Authorization", c.authorization)
+	if jar := c.session.GetClient().Jar; jar != nil {
+		for _, cookie := range jar.Cookies(base) {
+			cfg.Header.Add("Cookie", cookie.String())
+		}
+	}
+
+	conn, err := cfg.DialContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to websocket: %w", err)
+	}
+	return conn, base, nil
+}
+
+// watchJob follows a job over the controller's websocket until it finishes
+// or times out, delivering its events through stream. Any error other than
+// a *JobTimeoutError or a canceled context means the socket could not be
+// used and the caller should poll instead.
+func (c *AAPClient) watchJob(ctx context.Context, kind JobKind, jobID int, stream *eventStream, opts PollOptions, clock *jobClock) (JobStatus, error) {
+	conn, base, err := c.dialWebsocket(ctx)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// The controller only accepts the subscription if xrftoken matches the
+	// session's CSRF token.
+	groups := map[string]interface{}{"jobs": []string{"status_changed"}}
+	if stream != nil {
+		groups[kind.group] = []int{jobID}
+	}
+	csrfToken, _ := c.sessionCookies(base)
+	subscribe := map[string]interface{}{"groups": groups, "xrftoken": csrfToken}
+	if err := websocket.JSON.Send(conn, subscribe); err != nil {
+		return JobStatus{}, fmt.Errorf("failed to subscribe to job %d: %w", jobID, err)
+	}
+
+	// The job may have finished before the subscription took effect.
+	result, err := c.getStatus(ctx, kind.url(jobID, ""), jobID)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	clock.observe(result.Status)
+	if result.finished() {
+		return result, nil
+	}
+	var queue QueueInfo
+	if queued(result.Status) && opts.OnQueue != nil {
+		queue = c.queueInfo(ctx, result)
+		opts.OnQueue(queue)
+	}
+
+	eventGroup := fmt.Sprintf("%s-%d", kind.group, jobID)
+	for {
+		if err := conn.SetReadDeadline(clock.deadline()); err != nil {
+			return JobStatus{}, err
+		}
+		var data []byte
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if err := clock.expired(); err != nil {
+					return JobStatus{}, err
+				}
+			}
+			return JobStatus{}, fmt.Errorf("websocket closed while watching job %d: %w", jobID, err)
+		}
+
+		var msg socketMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return JobStatus{}, fmt.Errorf("failed to parse websocket message: %w", err)
+		}
+		switch {
+		case msg.Error != "":
+			return JobStatus{}, fmt.Errorf("websocket subscription refused: %s", msg.Error)
+		case msg.GroupName == "jobs" && msg.UnifiedJobID == jobID:
+			status := JobStatus{ID: jobID, Status: msg.Status}
+			clock.observe(status.Status)
+			if queued(status.Status) && opts.OnQueue != nil {
+				// Status messages lack the instance group and queue
+				// position, so they are fetched, or kept from before if
+				// that fails.
+				queue.Status = status.Status
+				if detail, err := c.getStatus(ctx, kind.url(jobID, ""), jobID); err == nil && queued(detail.Status) {
+					queue = c.queueInfo(ctx, detail)
+				}
+				opts.OnQueue(queue)
+			}
+			if status.finished() {
+				// Status messages lack the explanation and host counts.
+				detail, err := c.getStatus(ctx, kind.url(jobID, ""), jobID)
+				if err == nil && detail.finished() {
+					return detail, nil
+				}
+				return status, nil
+			}
+		case msg.GroupName == eventGroup && stream != nil:
+			var e JobEvent
+			if err := json.Unmarshal(data, &e); err != nil {
+				return JobStatus{}, fmt.Errorf("failed to parse job event: %w", err)
+			}
+			stream.add(e)
+			stream.flush(false, opts.OnEvent)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package client_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
+)
+
+// newWebsocketStandIn serves the controller's websocket with handler and
+// the REST endpoints of job 999, which goes through statuses, one per
+// request, and has the given events. A status starting with "{" is sent as
+// the whole job. Like the controller, it only accepts
+// subscriptions from a logged in session that sends its CSRF token back as
+// xrftoken, and rejects POST and DELETE requests that carry the session
+// cookie without the CSRF token.
+func newWebsocketStandIn(t *testing.T, statuses []string, events []int, handler func(*websocket.Conn)) *httptest.Server {
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/controller/login/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "form-token", Path: "/"})
+			return
+		}
+		if got := r.Header.Get("X-CSRFToken"); got != "form-token" {
+			t.Errorf("Expected the login to carry the form's CSRF token, got %q", got)
+		}
+		if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+			// The controller renders the form again.
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "awx_sessionid", Value: "session", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "session-token", Path: "/"})
+	})
+	mux.Handle("/api/controller/websocket/", websocket.Handler(func(ws *websocket.Conn) {
+		var subscribe struct {
+			Groups   map[string]json.RawMessage `json:"groups"`
+			XRFToken string                     `json:"xrftoken"`
+		}
+		if err := websocket.JSON.Receive(ws, &subscribe); err != nil {
+			t.Errorf("Failed to receive subscription: %v", err)
+			return
+		}
+		session, err := ws.Request().Cookie("awx_sessionid")
+		if err != nil || session.Value != "session" || subscribe.XRFToken != "session-token" {
+			_ = websocket.JSON.Send(ws, map[string]interface{}{"error": "access denied to channel"})
+			return
+		}
+		if string(subscribe.Groups["job_events"]) != "[999]" {
+			t.Errorf("Expected subscription to job 999 events, got %s", subscribe.Groups["job_events"])
+		}
+		handler(ws)
+	}))
+	mux.HandleFunc("/api/controller/v2/jobs/999/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		mu.Unlock()
+		if strings.HasPrefix(status, "{") {
+			_, _ = w.Write([]byte(status))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"status": %q}`, status)
+	})
+	mux.HandleFunc("/api/controller/v2/jobs/999/job_events/", func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w, r, events)
+	})
+	mux.HandleFunc("/api/controller/v2/inventories/7/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := r.Cookie("awx_sessionid")
+		unsafe := r.Method == http.MethodPost || r.Method == http.MethodDelete
+		if err == nil && unsafe && r.URL.Path != "/api/controller/login/" && r.Header.Get("X-CSRFToken") != "session-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"detail": "CSRF Failed: CSRF token missing."}`))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func sendEvent(t *testing.T, ws *websocket.Conn, counter int) {
+	t.Helper()
+	err := websocket.JSON.Send(ws, map[string]interface{}{
+		"group_name": "job_events-999",
+		"counter":    counter,
+		"stdout":     fmt.Sprintf("line %d", counter),
+	})
+	if err != nil {
+		t.Errorf("Failed to send event: %v", err)
+	}
+}
+
+func TestAAPClient_PollJob_Websocket(t *testing.T) {
+	server := newWebsocketStandIn(t, []string{"running"}, []int{1, 2, 3}, func(ws *websocket.Conn) {
+		sendEvent(t, ws, 2)
+		sendEvent(t, ws, 1)
+		if err := websocket.JSON.Send(ws, map[string]interface{}{
+			"group_name":     "jobs",
+			"unified_job_id": 999,
+			"status":         "successful",
+		}); err != nil {
+			t.Errorf("Failed to send status: %v", err)
+		}
+		// Keep the socket open until the client hangs up.
+		var discard interface{}
+		_ = websocket.JSON.Receive(ws, &discard)
+	})
+	defer server.Close()
+
+	c := newJobsTestClient(server.URL)
+	var got []int
+	err := c.PollJob(t.Context(), 999, client.PollOptions{
+		Timeout: 30 * time.Second,
+		// Polling would not finish within the test's timeout.
+		PollInterval: time.Hour,
+		Websocket:    true,
+		OnEvent: func(e client.JobEvent) {
+			got = append(got, e.Counter)
+		},
+		OnFallback: func(err error) {
+			t.Errorf("Expected no fallback to polling, got %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []int{1, 2, 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
+
+func TestAAPClient_PollJob_WebsocketSessionStaysOutOfREST(t *testing.T) {
+	server := newWebsocketStandIn(t, []string{"running", "successful"}, []int{1}, func(ws *websocket.Conn) {
+		if err := websocket.JSON.Send(ws, map[string]interface{}{
+			"group_name":     "jobs",
+			"unified_job_id": 999,
+			"status":         "successful",
+		}); err != nil {
+			t.Errorf("Failed to send status: %v", err)
+		}
+		var discard interface{}
+		_ = websocket.JSON.Receive(ws, &discard)
+	})
+	defer server.Close()
+
+	c := newJobsTestClient(server.URL)
+	err := c.PollJob(t.Context(), 999, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Hour,
+		Websocket:    true,
+		OnEvent:      func(client.JobEvent) {},
+		OnFallback: func(err error) {
+			t.Errorf("Expected no fallback to polling, got %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Cleanup after a watched job must still be accepted.
+	if err := c.DeleteInventory(t.Context(), 7); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestAAPClient_PollJob_WebsocketFallsBackToPolling(t *testing.T) {
+	server := newWebsocketStandIn(t, []string{"running", "failed"}, []int{1, 2}, func(ws *websocket.Conn) {
+		sendEvent(t, ws, 1)
+		// Returning drops the connection.
+	})
+	defer server.Close()
+
+	c := newJobsTestClient(server.URL)
+	var got []int
+	var fallback error
+	err := c.PollJob(t.Context(), 999, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+		Websocket:    true,
+		OnEvent: func(e client.JobEvent) {
+			got = append(got, e.Counter)
+		},
+		OnFallback: func(err error) {
+			fallback = err
+		},
+	})
+	if err == nil {
+		t.Fatal("Expected error for failed job, got nil")
+	}
+
+	want := []int{1, 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+	if fallback == nil {
+		t.Error("Expected the dropped socket to be reported")
+	}
+}
+
+func TestAAPClient_PollJob_WebsocketNeedsSession(t *testing.T) {
+	server := newWebsocketStandIn(t, []string{"running", "successful"}, []int{1}, func(ws *websocket.Conn) {
+		t.Error("Expected no subscription without a session")
+	})
+	defer server.Close()
+
+	c := client.NewAAPClient(config.Config{
+		TowerHost:          server.URL,
+		AccessToken:        "token123",
+		Timeout:            30 * time.Second,
+		InsecureSkipVerify: true,
+	})
+	var fallback error
+	err := c.PollJob(t.Context(), 999, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Millisecond,
+		Websocket:    true,
+		OnFallback: func(err error) {
+			fallback = err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fallback == nil || !strings.Contains(fallback.Error(), "session login") {
+		t.Errorf("Expected a fallback because token authentication has no session, got %v", fallback)
+	}
+}
+
+func TestAAPClient_PollJob_WebsocketQueueInfo(t *testing.T) {
+	waiting := `{"status": "waiting", "summary_fields": {"instance_group": {"id": 2, "name": "default"}}}`
+	server := newWebsocketStandIn(t, []string{waiting, waiting, "successful"}, nil, func(ws *websocket.Conn) {
+		for _, status := range []string{"waiting", "successful"} {
+			if err := websocket.JSON.Send(ws, map[string]interface{}{
+				"group_name":     "jobs",
+				"unified_job_id": 999,
+				"status":         status,
+			}); err != nil {
+				t.Errorf("Failed to send status: %v", err)
+			}
+		}
+		var discard interface{}
+		_ = websocket.JSON.Receive(ws, &discard)
+	})
+	defer server.Close()
+
+	var queue []client.QueueInfo
+	err := newJobsTestClient(server.URL).PollJob(t.Context(), 999, client.PollOptions{
+		Timeout:      30 * time.Second,
+		PollInterval: time.Hour,
+		Websocket:    true,
+		OnQueue: func(info client.QueueInfo) {
+			queue = append(queue, info)
+		},
+		OnEvent: func(client.JobEvent) {},
+		OnFallback: func(err error) {
+			t.Errorf("Expected no fallback to polling, got %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []client.QueueInfo{
+		{Status: "waiting", InstanceGroup: "default"},
+		{Status: "waiting", InstanceGroup: "default"},
+	}
+	if !reflect.DeepEqual(queue, want) {
+		t.Errorf("Expected queue info %+v, got %+v", want, queue)
+	}
+}
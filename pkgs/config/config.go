@@ -1,30 +1,206 @@
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,AdditionalHost,RetryConfig
 
 package config
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 	"time"
+
+	packerconfig "github.com/hashicorp/packer-plugin-sdk/template/config"
 )
 
 type Config struct {
-	TowerHost          string                 `mapstructure:"tower_host"`
-	Username           string                 `mapstructure:"username"`
-	Password           string                 `mapstructure:"password"`
-	AccessToken        string                 `mapstructure:"access_token"`
-	JobTemplateID      int                    `mapstructure:"job_template_id"`
-	InventoryID        int                    `mapstructure:"inventory_id"`
-	OrganizationID     int                    `mapstructure:"organization_id"`
-	DynamicInventory   bool                   `mapstructure:"dynamic_inventory"`
-	KeepTempInventory  bool                   `mapstructure:"keep_temp_inventory,default=false"`
-	KeepTempCredential bool                   `mapstructure:"keep_temp_credential,default=false"`
-	CreateCredential   bool                   `mapstructure:"create_credential,default=true"`
-	ExtraVars          map[string]interface{} `mapstructure:"extra_vars"`
-	Timeout            time.Duration          `mapstructure:"timeout"`
-	PollInterval       time.Duration          `mapstructure:"poll_interval"`
-	WorkflowTemplateID int                    `mapstructure:"workflow_template_id"`
-	InsecureSkipVerify bool                   `mapstructure:"insecure_skip_verify,default=false"`
+	TowerHost              string                            `mapstructure:"tower_host"`
+	Username               string                            `mapstructure:"username"`
+	Password               string                            `mapstructure:"password"`
+	AccessToken            string                            `mapstructure:"access_token"`
+	JobTemplateID          int                               `mapstructure:"job_template_id"`
+	InventoryID            int                               `mapstructure:"inventory_id"`
+	OrganizationID         int                               `mapstructure:"organization_id"`
+	DynamicInventory       bool                              `mapstructure:"dynamic_inventory"`
+	KeepTempInventory      bool                              `mapstructure:"keep_temp_inventory,default=false"`
+	KeepTempCredential     bool                              `mapstructure:"keep_temp_credential,default=false"`
+	CreateCredential       packerconfig.Trilean              `mapstructure:"create_credential,default=true"`
+	ExtraVars              map[string]interface{}            `mapstructure:"extra_vars"`
+	Timeout                time.Duration                     `mapstructure:"timeout"`
+	QueueTimeout           time.Duration                     `mapstructure:"queue_timeout"`
+	RunTimeout             time.Duration                     `mapstructure:"run_timeout"`
+	PollInterval           time.Duration                     `mapstructure:"poll_interval"`
+	UseWebsocket           bool                              `mapstructure:"use_websocket"`
+	Retry                  RetryConfig                       `mapstructure:"retry"`
+	Preflight              bool                              `mapstructure:"preflight"`
+	PreflightModule        string                            `mapstructure:"preflight_module"`
+	PreflightModuleArgs    string                            `mapstructure:"preflight_module_args"`
+	PreflightTimeout       time.Duration                     `mapstructure:"preflight_timeout"`
+	PreflightInterval      time.Duration                     `mapstructure:"preflight_interval"`
+	WorkflowTemplateID     int                               `mapstructure:"workflow_template_id"`
+	ProjectID              int                               `mapstructure:"project_id"`
+	ProjectName            string                            `mapstructure:"project_name"`
+	Playbook               string                            `mapstructure:"playbook"`
+	ExecutionEnvironmentID int                               `mapstructure:"execution_environment_id"`
+	InstanceGroupIDs       []int                             `mapstructure:"instance_group_ids"`
+	JobTimeout             time.Duration                     `mapstructure:"job_timeout"`
+	ProjectUpdate          bool                              `mapstructure:"project_update"`
+	ProjectUpdateTimeout   time.Duration                     `mapstructure:"project_update_timeout"`
+	ModuleName             string                            `mapstructure:"module_name"`
+	ModuleArgs             string                            `mapstructure:"module_args"`
+	Become                 bool                              `mapstructure:"become"`
+	Verbosity              int                               `mapstructure:"verbosity"`
+	InsecureSkipVerify     bool                              `mapstructure:"insecure_skip_verify,default=false"`
+	SSHPrivateKeyFile      string                            `mapstructure:"ssh_private_key_file"`
+	SSHKeyPassphrase       string                            `mapstructure:"ssh_key_passphrase"`
+	SSHCertificateFile     string                            `mapstructure:"ssh_certificate_file"`
+	BecomeMethod           string                            `mapstructure:"become_method"`
+	BecomeUsername         string                            `mapstructure:"become_username"`
+	BecomePassword         string                            `mapstructure:"become_password"`
+	CredentialIDs          []int                             `mapstructure:"credential_ids"`
+	CredentialNames        []string                          `mapstructure:"credential_names"`
+	VaultPassword          string                            `mapstructure:"vault_password"`
+	VaultID                string                            `mapstructure:"vault_id"`
+	SecretVars             map[string]string                 `mapstructure:"secret_vars"`
+	SecretVarsInjector     string                            `mapstructure:"secret_vars_injector"`
+	HostVars               map[string]interface{}            `mapstructure:"host_vars"`
+	Groups                 []string                          `mapstructure:"groups"`
+	GroupVars              map[string]map[string]interface{} `mapstructure:"group_vars"`
+	InventoryVars          map[string]interface{}            `mapstructure:"inventory_vars"`
+	AdditionalHosts        []AdditionalHost                  `mapstructure:"additional_host"`
+	Connection             string                            `mapstructure:"connection"`
+
+	WinRMTransport         string               `mapstructure:"winrm_transport"`
+	WinRMUseNTLM           bool                 `mapstructure:"winrm_use_ntlm"`
+	WinRMUseSSL            packerconfig.Trilean `mapstructure:"winrm_use_ssl"`
+	WinRMInsecure          packerconfig.Trilean `mapstructure:"winrm_insecure"`
+	WinRMCATrustPath       string               `mapstructure:"winrm_ca_trust_path"`
+	WinRMMessageEncryption string               `mapstructure:"winrm_message_encryption"`
+	WinRMOperationTimeout  time.Duration        `mapstructure:"winrm_operation_timeout"`
+	WinRMReadTimeout       time.Duration        `mapstructure:"winrm_read_timeout"`
+
+	OSType           string `mapstructure:"os_type"`
+	WindowsShellType string `mapstructure:"windows_shell_type"`
+
+	HostAddressSource string `mapstructure:"host_address_source"`
+	// HostAddress is rendered as a template over the build's generated
+	// data at provisioning time, e.g. "{{ .PrivateIP }}".
+	HostAddress string `mapstructure:"host_address"`
+	HostName    string `mapstructure:"host_name"`
+}
+
+// HostAddressSources maps host_address_source values to the generated data
+// key holding the address.
+var HostAddressSources = map[string]string{
+	"host":        "Host",
+	"private_ip":  "PrivateIP",
+	"public_ip":   "PublicIP",
+	"private_dns": "PrivateDNS",
+	"public_dns":  "PublicDNS",
+}
+
+// AdditionalHost is an extra host added to the temporary inventory next to
+// the build VM, such as a license server or localhost for delegated tasks.
+type AdditionalHost struct {
+	// Name is the inventory hostname.
+	Name string `mapstructure:"name"`
+	// Address is the ansible_host to connect to. Defaults to Name.
+	Address string `mapstructure:"address"`
+	Port    int    `mapstructure:"port"`
+	User    string `mapstructure:"user"`
+	// Password is set as ansible_password on the host. It is readable by
+	// anyone who can read the inventory until the host is removed.
+	Password string                 `mapstructure:"password"`
+	Vars     map[string]interface{} `mapstructure:"vars"`
+	Groups   []string               `mapstructure:"groups"`
+}
+
+// RetryConfig controls relaunching a job that failed in a way that a second
+// attempt may fix, such as a host that was not reachable yet.
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts, including the first
+	// launch. 0 and 1 disable retries.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// Delay is the wait before each relaunch. Defaults to 30s.
+	Delay time.Duration `mapstructure:"delay"`
+	// On lists the outcomes to retry: "unreachable", "failed" and "error".
+	// Defaults to ["unreachable"].
+	On []string `mapstructure:"on"`
+}
+
+// retryOutcomes are the job outcomes a retry can be configured for.
+var retryOutcomes = map[string]bool{"unreachable": true, "failed": true, "error": true}
+
+func (r *RetryConfig) validate(relaunchable bool) error {
+	if r.MaxAttempts < 0 || r.Delay < 0 {
+		return errors.New("retry max_attempts and delay must not be negative")
+	}
+	for _, outcome := range r.On {
+		if !retryOutcomes[outcome] {
+			return fmt.Errorf("retry on %q is not one of unreachable, failed or error", outcome)
+		}
+	}
+	if r.MaxAttempts <= 1 {
+		return nil
+	}
+	if !relaunchable {
+		return errors.New("retry requires job_template_id or playbook, workflow jobs and ad hoc commands are not relaunched")
+	}
+	if len(r.On) == 0 {
+		r.On = []string{"unreachable"}
+	}
+	if r.Delay == 0 {
+		r.Delay = 30 * time.Second
+	}
+	return nil
+}
+
+// secretVarPattern matches names usable as credential type input IDs.
+var secretVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateGroupName rejects names the temporary inventory cannot use as a
+// group: empty names and Ansible's implicit groups.
+func validateGroupName(name string) error {
+	switch name {
+	case "":
+		return errors.New("group names must not be empty")
+	case "all", "ungrouped":
+		return fmt.Errorf("group %q is implicit in Ansible and cannot be created", name)
+	}
+	return nil
+}
+
+// validateWinRM checks the WinRM options and fills in the read timeout,
+// which pywinrm requires to exceed the operation timeout.
+func (c *Config) validateWinRM() error {
+	switch c.WinRMTransport {
+	case "", "basic", "ntlm", "kerberos", "credssp":
+	default:
+		return errors.New("winrm_transport must be one of basic, ntlm, kerberos or credssp")
+	}
+	if c.WinRMUseNTLM && c.WinRMTransport != "" && c.WinRMTransport != "ntlm" {
+		return fmt.Errorf("winrm_use_ntlm conflicts with winrm_transport %q", c.WinRMTransport)
+	}
+
+	switch c.WinRMMessageEncryption {
+	case "", "auto", "always", "never":
+	default:
+		return errors.New("winrm_message_encryption must be one of auto, always or never")
+	}
+
+	if c.WinRMCATrustPath != "" && c.WinRMInsecure.True() {
+		return errors.New("winrm_ca_trust_path cannot be used with winrm_insecure")
+	}
+
+	if c.WinRMOperationTimeout < 0 || c.WinRMReadTimeout < 0 {
+		return errors.New("winrm_operation_timeout and winrm_read_timeout must not be negative")
+	}
+	if c.WinRMOperationTimeout > 0 && c.WinRMReadTimeout == 0 {
+		c.WinRMReadTimeout = c.WinRMOperationTimeout + 10*time.Second
+	}
+	if c.WinRMReadTimeout > 0 && c.WinRMReadTimeout <= c.WinRMOperationTimeout {
+		return errors.New("winrm_read_timeout must be greater than winrm_operation_timeout")
+	}
+	return nil
 }
 
 func (c *Config) Validate() error {
@@ -45,8 +221,38 @@ func (c *Config) Validate() error {
 		}
 	}
 
-	if c.JobTemplateID == 0 && c.WorkflowTemplateID == 0 {
-		return errors.New("either job_template_id or workflow_template_id must be set")
+	if c.JobTemplateID == 0 && c.WorkflowTemplateID == 0 && c.Playbook == "" && c.ModuleName == "" {
+		return errors.New("one of job_template_id, workflow_template_id, playbook or module_name must be set")
+	}
+	if c.Playbook != "" && (c.JobTemplateID != 0 || c.WorkflowTemplateID != 0 || c.ModuleName != "") {
+		return errors.New("playbook runs a temporary job template and cannot be combined with job_template_id, workflow_template_id or module_name")
+	}
+	if c.Playbook != "" && (c.ProjectID == 0) == (c.ProjectName == "") {
+		return errors.New("playbook requires exactly one of project_id or project_name")
+	}
+	if c.Playbook == "" && (c.ProjectID != 0 || c.ProjectName != "" || c.ExecutionEnvironmentID != 0 || len(c.InstanceGroupIDs) > 0 || c.JobTimeout != 0) {
+		return errors.New("project_id, project_name, execution_environment_id, instance_group_ids and job_timeout require playbook")
+	}
+	if c.JobTimeout < 0 {
+		return errors.New("job_timeout must not be negative")
+	}
+	if c.ModuleName != "" && (c.JobTemplateID != 0 || c.WorkflowTemplateID != 0) {
+		return errors.New("module_name runs an ad hoc command and cannot be combined with job_template_id or workflow_template_id")
+	}
+	if c.ModuleName == "" && (c.ModuleArgs != "" || c.Become) {
+		return errors.New("module_args and become require module_name")
+	}
+	if c.ProjectUpdate && c.JobTemplateID == 0 && c.Playbook == "" {
+		return errors.New("project_update requires job_template_id or playbook")
+	}
+	if c.ProjectUpdateTimeout < 0 {
+		return errors.New("project_update_timeout must not be negative")
+	}
+	if c.ProjectUpdateTimeout == 0 {
+		c.ProjectUpdateTimeout = 10 * time.Minute
+	}
+	if c.Verbosity < 0 || c.Verbosity > 5 {
+		return errors.New("verbosity must be between 0 and 5")
 	}
 	if c.DynamicInventory && c.OrganizationID == 0 {
 		return errors.New("organization_id must be set when dynamic_inventory is true")
@@ -54,15 +260,138 @@ func (c *Config) Validate() error {
 	if c.Timeout == 0 {
 		c.Timeout = 15 * time.Minute
 	}
+	if c.QueueTimeout < 0 || c.RunTimeout < 0 {
+		return errors.New("queue_timeout and run_timeout must not be negative")
+	}
+	// timeout caps the job as a whole, so neither phase can be given more.
+	if c.QueueTimeout > c.Timeout || c.RunTimeout > c.Timeout {
+		return fmt.Errorf("queue_timeout and run_timeout must not exceed timeout (%s)", c.Timeout)
+	}
 	if c.PollInterval == 0 {
 		c.PollInterval = 10 * time.Second
 	}
+	if err := c.Retry.validate(c.JobTemplateID != 0 || c.Playbook != ""); err != nil {
+		return err
+	}
+	if c.PreflightTimeout < 0 || c.PreflightInterval < 0 {
+		return errors.New("preflight_timeout and preflight_interval must not be negative")
+	}
+	if c.PreflightTimeout == 0 {
+		c.PreflightTimeout = 10 * time.Minute
+	}
+	if c.PreflightInterval == 0 {
+		c.PreflightInterval = 15 * time.Second
+	}
 	if c.ExtraVars == nil {
 		c.ExtraVars = make(map[string]interface{})
 	}
 
-	if !c.CreateCredential {
-		c.CreateCredential = true
+	if c.SSHCertificateFile != "" && c.SSHPrivateKeyFile == "" {
+		return errors.New("ssh_certificate_file requires ssh_private_key_file")
+	}
+
+	if c.VaultID != "" && c.VaultPassword == "" {
+		return errors.New("vault_password must be set when vault_id is set")
+	}
+
+	for key := range c.SecretVars {
+		if !secretVarPattern.MatchString(key) {
+			return fmt.Errorf("secret_vars key %q must be a valid variable name", key)
+		}
+		if _, ok := c.ExtraVars[key]; ok {
+			return fmt.Errorf("secret_vars key %q is also set in extra_vars", key)
+		}
+	}
+	switch c.SecretVarsInjector {
+	case "":
+		c.SecretVarsInjector = "extra_vars"
+	case "extra_vars", "env":
+	default:
+		return errors.New("secret_vars_injector must be either extra_vars or env")
+	}
+
+	seenGroups := make(map[string]bool, len(c.Groups))
+	for _, group := range c.Groups {
+		if err := validateGroupName(group); err != nil {
+			return err
+		}
+		if seenGroups[group] {
+			return fmt.Errorf("group %q is listed more than once", group)
+		}
+		seenGroups[group] = true
+	}
+	hostNames := make(map[string]bool, len(c.AdditionalHosts))
+	for i, host := range c.AdditionalHosts {
+		if host.Name == "" {
+			return fmt.Errorf("additional_host %d: name must be set", i)
+		}
+		if hostNames[host.Name] {
+			return fmt.Errorf("additional_host %q is defined more than once", host.Name)
+		}
+		hostNames[host.Name] = true
+		for _, group := range host.Groups {
+			if err := validateGroupName(group); err != nil {
+				return fmt.Errorf("additional_host %q: %w", host.Name, err)
+			}
+			seenGroups[group] = true
+		}
+	}
+
+	for group := range c.GroupVars {
+		if !seenGroups[group] {
+			return fmt.Errorf("group_vars sets variables for %q, which is not listed in groups or any additional_host groups", group)
+		}
+	}
+
+	switch c.Connection {
+	case "", "ssh", "winrm":
+	default:
+		return errors.New("connection must be either ssh or winrm")
+	}
+
+	if err := c.validateWinRM(); err != nil {
+		return err
+	}
+
+	if c.HostAddress != "" && c.HostAddressSource != "" {
+		return errors.New("host_address and host_address_source cannot both be set")
+	}
+	if c.HostAddressSource == "" && c.HostAddress == "" {
+		c.HostAddressSource = "host"
+	}
+	if _, ok := HostAddressSources[c.HostAddressSource]; c.HostAddressSource != "" && !ok {
+		return errors.New("host_address_source must be one of host, private_ip, public_ip, private_dns or public_dns")
+	}
+
+	switch c.OSType {
+	case "", "linux", "windows":
+	default:
+		return errors.New("os_type must be either linux or windows")
+	}
+	switch c.WindowsShellType {
+	case "", "powershell", "cmd":
+	default:
+		return errors.New("windows_shell_type must be either powershell or cmd")
+	}
+
+	// create_credential defaults to true; false relies on the template's own
+	// machine credential.
+	if c.CreateCredential == packerconfig.TriUnset {
+		c.CreateCredential = packerconfig.TriTrue
+	}
+	// The preflight's ad hoc command needs a machine credential, which
+	// workflow templates leave to their nodes.
+	if c.Preflight && c.CreateCredential.False() && c.JobTemplateID == 0 && c.WorkflowTemplateID != 0 {
+		return errors.New("preflight with create_credential = false needs the machine credential of a job_template_id, credential_ids or credential_names, which workflow_template_id does not provide")
+	}
+	// Ad hoc commands take a single machine credential.
+	if c.ModuleName != "" {
+		if c.VaultPassword != "" || len(c.SecretVars) > 0 {
+			return errors.New("vault_password and secret_vars cannot be used with module_name, ad hoc commands only take a machine credential")
+		}
+		if c.CreateCredential.True() && (len(c.CredentialIDs) > 0 || len(c.CredentialNames) > 0) {
+			return errors.New("with module_name, credential_ids and credential_names select the machine credential and require create_credential = false")
+		}
 	}
 	return nil
 }
@@ -7,25 +7,112 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
+// FlatAdditionalHost is an auto-generated flat version of AdditionalHost.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatAdditionalHost struct {
+	Name     *string                `mapstructure:"name" cty:"name" hcl:"name"`
+	Address  *string                `mapstructure:"address" cty:"address" hcl:"address"`
+	Port     *int                   `mapstructure:"port" cty:"port" hcl:"port"`
+	User     *string                `mapstructure:"user" cty:"user" hcl:"user"`
+	Password *string                `mapstructure:"password" cty:"password" hcl:"password"`
+	Vars     map[string]interface{} `mapstructure:"vars" cty:"vars" hcl:"vars"`
+	Groups   []string               `mapstructure:"groups" cty:"groups" hcl:"groups"`
+}
+
+// FlatMapstructure returns a new FlatAdditionalHost.
+// FlatAdditionalHost is an auto-generated flat version of AdditionalHost.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*AdditionalHost) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatAdditionalHost)
+}
+
+// HCL2Spec returns the hcl spec of a AdditionalHost.
+// This spec is used by HCL to read the fields of AdditionalHost.
+// The decoded values from this spec will then be applied to a FlatAdditionalHost.
+func (*FlatAdditionalHost) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":     &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"address":  &hcldec.AttrSpec{Name: "address", Type: cty.String, Required: false},
+		"port":     &hcldec.AttrSpec{Name: "port", Type: cty.Number, Required: false},
+		"user":     &hcldec.AttrSpec{Name: "user", Type: cty.String, Required: false},
+		"password": &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false},
+		"vars":     &hcldec.AttrSpec{Name: "vars", Type: cty.Map(cty.String), Required: false},
+		"groups":   &hcldec.AttrSpec{Name: "groups", Type: cty.List(cty.String), Required: false},
+	}
+	return s
+}
+
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	TowerHost          *string                `mapstructure:"tower_host" cty:"tower_host" hcl:"tower_host"`
-	Username           *string                `mapstructure:"username" cty:"username" hcl:"username"`
-	Password           *string                `mapstructure:"password" cty:"password" hcl:"password"`
-	AccessToken        *string                `mapstructure:"access_token" cty:"access_token" hcl:"access_token"`
-	JobTemplateID      *int                   `mapstructure:"job_template_id" cty:"job_template_id" hcl:"job_template_id"`
-	InventoryID        *int                   `mapstructure:"inventory_id" cty:"inventory_id" hcl:"inventory_id"`
-	OrganizationID     *int                   `mapstructure:"organization_id" cty:"organization_id" hcl:"organization_id"`
-	DynamicInventory   *bool                  `mapstructure:"dynamic_inventory" cty:"dynamic_inventory" hcl:"dynamic_inventory"`
-	KeepTempInventory  *bool                  `mapstructure:"keep_temp_inventory,default=false" cty:"keep_temp_inventory" hcl:"keep_temp_inventory"`
-	KeepTempCredential *bool                  `mapstructure:"keep_temp_credential,default=false" cty:"keep_temp_credential" hcl:"keep_temp_credential"`
-	CreateCredential   *bool                  `mapstructure:"create_credential,default=true" cty:"create_credential" hcl:"create_credential"`
-	ExtraVars          map[string]interface{} `mapstructure:"extra_vars" cty:"extra_vars" hcl:"extra_vars"`
-	Timeout            *string                `mapstructure:"timeout" cty:"timeout" hcl:"timeout"`
-	PollInterval       *string                `mapstructure:"poll_interval" cty:"poll_interval" hcl:"poll_interval"`
-	WorkflowTemplateID *int                   `mapstructure:"workflow_template_id" cty:"workflow_template_id" hcl:"workflow_template_id"`
-	InsecureSkipVerify *bool                  `mapstructure:"insecure_skip_verify,default=false" cty:"insecure_skip_verify" hcl:"insecure_skip_verify"`
+	TowerHost              *string                           `mapstructure:"tower_host" cty:"tower_host" hcl:"tower_host"`
+	Username               *string                           `mapstructure:"username" cty:"username" hcl:"username"`
+	Password               *string                           `mapstructure:"password" cty:"password" hcl:"password"`
+	AccessToken            *string                           `mapstructure:"access_token" cty:"access_token" hcl:"access_token"`
+	JobTemplateID          *int                              `mapstructure:"job_template_id" cty:"job_template_id" hcl:"job_template_id"`
+	InventoryID            *int                              `mapstructure:"inventory_id" cty:"inventory_id" hcl:"inventory_id"`
+	OrganizationID         *int                              `mapstructure:"organization_id" cty:"organization_id" hcl:"organization_id"`
+	DynamicInventory       *bool                             `mapstructure:"dynamic_inventory" cty:"dynamic_inventory" hcl:"dynamic_inventory"`
+	KeepTempInventory      *bool                             `mapstructure:"keep_temp_inventory,default=false" cty:"keep_temp_inventory" hcl:"keep_temp_inventory"`
+	KeepTempCredential     *bool                             `mapstructure:"keep_temp_credential,default=false" cty:"keep_temp_credential" hcl:"keep_temp_credential"`
+	CreateCredential       *bool                             `mapstructure:"create_credential,default=true" cty:"create_credential" hcl:"create_credential"`
+	ExtraVars              map[string]interface{}            `mapstructure:"extra_vars" cty:"extra_vars" hcl:"extra_vars"`
+	Timeout                *string                           `mapstructure:"timeout" cty:"timeout" hcl:"timeout"`
+	QueueTimeout           *string                           `mapstructure:"queue_timeout" cty:"queue_timeout" hcl:"queue_timeout"`
+	RunTimeout             *string                           `mapstructure:"run_timeout" cty:"run_timeout" hcl:"run_timeout"`
+	PollInterval           *string                           `mapstructure:"poll_interval" cty:"poll_interval" hcl:"poll_interval"`
+	UseWebsocket           *bool                             `mapstructure:"use_websocket" cty:"use_websocket" hcl:"use_websocket"`
+	Retry                  *FlatRetryConfig                  `mapstructure:"retry" cty:"retry" hcl:"retry"`
+	Preflight              *bool                             `mapstructure:"preflight" cty:"preflight" hcl:"preflight"`
+	PreflightModule        *string                           `mapstructure:"preflight_module" cty:"preflight_module" hcl:"preflight_module"`
+	PreflightModuleArgs    *string                           `mapstructure:"preflight_module_args" cty:"preflight_module_args" hcl:"preflight_module_args"`
+	PreflightTimeout       *string                           `mapstructure:"preflight_timeout" cty:"preflight_timeout" hcl:"preflight_timeout"`
+	PreflightInterval      *string                           `mapstructure:"preflight_interval" cty:"preflight_interval" hcl:"preflight_interval"`
+	WorkflowTemplateID     *int                              `mapstructure:"workflow_template_id" cty:"workflow_template_id" hcl:"workflow_template_id"`
+	ProjectID              *int                              `mapstructure:"project_id" cty:"project_id" hcl:"project_id"`
+	ProjectName            *string                           `mapstructure:"project_name" cty:"project_name" hcl:"project_name"`
+	Playbook               *string                           `mapstructure:"playbook" cty:"playbook" hcl:"playbook"`
+	ExecutionEnvironmentID *int                              `mapstructure:"execution_environment_id" cty:"execution_environment_id" hcl:"execution_environment_id"`
+	InstanceGroupIDs       []int                             `mapstructure:"instance_group_ids" cty:"instance_group_ids" hcl:"instance_group_ids"`
+	JobTimeout             *string                           `mapstructure:"job_timeout" cty:"job_timeout" hcl:"job_timeout"`
+	ProjectUpdate          *bool                             `mapstructure:"project_update" cty:"project_update" hcl:"project_update"`
+	ProjectUpdateTimeout   *string                           `mapstructure:"project_update_timeout" cty:"project_update_timeout" hcl:"project_update_timeout"`
+	ModuleName             *string                           `mapstructure:"module_name" cty:"module_name" hcl:"module_name"`
+	ModuleArgs             *string                           `mapstructure:"module_args" cty:"module_args" hcl:"module_args"`
+	Become                 *bool                             `mapstructure:"become" cty:"become" hcl:"become"`
+	Verbosity              *int                              `mapstructure:"verbosity" cty:"verbosity" hcl:"verbosity"`
+	InsecureSkipVerify     *bool                             `mapstructure:"insecure_skip_verify,default=false" cty:"insecure_skip_verify" hcl:"insecure_skip_verify"`
+	SSHPrivateKeyFile      *string                           `mapstructure:"ssh_private_key_file" cty:"ssh_private_key_file" hcl:"ssh_private_key_file"`
+	SSHKeyPassphrase       *string                           `mapstructure:"ssh_key_passphrase" cty:"ssh_key_passphrase" hcl:"ssh_key_passphrase"`
+	SSHCertificateFile     *string                           `mapstructure:"ssh_certificate_file" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
+	BecomeMethod           *string                           `mapstructure:"become_method" cty:"become_method" hcl:"become_method"`
+	BecomeUsername         *string                           `mapstructure:"become_username" cty:"become_username" hcl:"become_username"`
+	BecomePassword         *string                           `mapstructure:"become_password" cty:"become_password" hcl:"become_password"`
+	CredentialIDs          []int                             `mapstructure:"credential_ids" cty:"credential_ids" hcl:"credential_ids"`
+	CredentialNames        []string                          `mapstructure:"credential_names" cty:"credential_names" hcl:"credential_names"`
+	VaultPassword          *string                           `mapstructure:"vault_password" cty:"vault_password" hcl:"vault_password"`
+	VaultID                *string                           `mapstructure:"vault_id" cty:"vault_id" hcl:"vault_id"`
+	SecretVars             map[string]string                 `mapstructure:"secret_vars" cty:"secret_vars" hcl:"secret_vars"`
+	SecretVarsInjector     *string                           `mapstructure:"secret_vars_injector" cty:"secret_vars_injector" hcl:"secret_vars_injector"`
+	HostVars               map[string]interface{}            `mapstructure:"host_vars" cty:"host_vars" hcl:"host_vars"`
+	Groups                 []string                          `mapstructure:"groups" cty:"groups" hcl:"groups"`
+	GroupVars              map[string]map[string]interface{} `mapstructure:"group_vars" cty:"group_vars" hcl:"group_vars"`
+	InventoryVars          map[string]interface{}            `mapstructure:"inventory_vars" cty:"inventory_vars" hcl:"inventory_vars"`
+	AdditionalHosts        []FlatAdditionalHost              `mapstructure:"additional_host" cty:"additional_host" hcl:"additional_host"`
+	Connection             *string                           `mapstructure:"connection" cty:"connection" hcl:"connection"`
+	WinRMTransport         *string                           `mapstructure:"winrm_transport" cty:"winrm_transport" hcl:"winrm_transport"`
+	WinRMUseNTLM           *bool                             `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
+	WinRMUseSSL            *bool                             `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
+	WinRMInsecure          *bool                             `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
+	WinRMCATrustPath       *string                           `mapstructure:"winrm_ca_trust_path" cty:"winrm_ca_trust_path" hcl:"winrm_ca_trust_path"`
+	WinRMMessageEncryption *string                           `mapstructure:"winrm_message_encryption" cty:"winrm_message_encryption" hcl:"winrm_message_encryption"`
+	WinRMOperationTimeout  *string                           `mapstructure:"winrm_operation_timeout" cty:"winrm_operation_timeout" hcl:"winrm_operation_timeout"`
+	WinRMReadTimeout       *string                           `mapstructure:"winrm_read_timeout" cty:"winrm_read_timeout" hcl:"winrm_read_timeout"`
+	OSType                 *string                           `mapstructure:"os_type" cty:"os_type" hcl:"os_type"`
+	WindowsShellType       *string                           `mapstructure:"windows_shell_type" cty:"windows_shell_type" hcl:"windows_shell_type"`
+	HostAddressSource      *string                           `mapstructure:"host_address_source" cty:"host_address_source" hcl:"host_address_source"`
+	HostAddress            *string                           `mapstructure:"host_address" cty:"host_address" hcl:"host_address"`
+	HostName               *string                           `mapstructure:"host_name" cty:"host_name" hcl:"host_name"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -40,22 +127,101 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"tower_host":           &hcldec.AttrSpec{Name: "tower_host", Type: cty.String, Required: false},
-		"username":             &hcldec.AttrSpec{Name: "username", Type: cty.String, Required: false},
-		"password":             &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false},
-		"access_token":         &hcldec.AttrSpec{Name: "access_token", Type: cty.String, Required: false},
-		"job_template_id":      &hcldec.AttrSpec{Name: "job_template_id", Type: cty.Number, Required: false},
-		"inventory_id":         &hcldec.AttrSpec{Name: "inventory_id", Type: cty.Number, Required: false},
-		"organization_id":      &hcldec.AttrSpec{Name: "organization_id", Type: cty.Number, Required: false},
-		"dynamic_inventory":    &hcldec.AttrSpec{Name: "dynamic_inventory", Type: cty.Bool, Required: false},
-		"keep_temp_inventory":  &hcldec.AttrSpec{Name: "keep_temp_inventory", Type: cty.Bool, Required: false},
-		"keep_temp_credential": &hcldec.AttrSpec{Name: "keep_temp_credential", Type: cty.Bool, Required: false},
-		"create_credential":    &hcldec.AttrSpec{Name: "create_credential", Type: cty.Bool, Required: false},
-		"extra_vars":           &hcldec.AttrSpec{Name: "extra_vars", Type: cty.Map(cty.String), Required: false},
-		"timeout":              &hcldec.AttrSpec{Name: "timeout", Type: cty.String, Required: false},
-		"poll_interval":        &hcldec.AttrSpec{Name: "poll_interval", Type: cty.String, Required: false},
-		"workflow_template_id": &hcldec.AttrSpec{Name: "workflow_template_id", Type: cty.Number, Required: false},
-		"insecure_skip_verify": &hcldec.AttrSpec{Name: "insecure_skip_verify", Type: cty.Bool, Required: false},
+		"tower_host":               &hcldec.AttrSpec{Name: "tower_host", Type: cty.String, Required: false},
+		"username":                 &hcldec.AttrSpec{Name: "username", Type: cty.String, Required: false},
+		"password":                 &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false},
+		"access_token":             &hcldec.AttrSpec{Name: "access_token", Type: cty.String, Required: false},
+		"job_template_id":          &hcldec.AttrSpec{Name: "job_template_id", Type: cty.Number, Required: false},
+		"inventory_id":             &hcldec.AttrSpec{Name: "inventory_id", Type: cty.Number, Required: false},
+		"organization_id":          &hcldec.AttrSpec{Name: "organization_id", Type: cty.Number, Required: false},
+		"dynamic_inventory":        &hcldec.AttrSpec{Name: "dynamic_inventory", Type: cty.Bool, Required: false},
+		"keep_temp_inventory":      &hcldec.AttrSpec{Name: "keep_temp_inventory", Type: cty.Bool, Required: false},
+		"keep_temp_credential":     &hcldec.AttrSpec{Name: "keep_temp_credential", Type: cty.Bool, Required: false},
+		"create_credential":        &hcldec.AttrSpec{Name: "create_credential", Type: cty.Bool, Required: false},
+		"extra_vars":               &hcldec.AttrSpec{Name: "extra_vars", Type: cty.Map(cty.String), Required: false},
+		"timeout":                  &hcldec.AttrSpec{Name: "timeout", Type: cty.String, Required: false},
+		"queue_timeout":            &hcldec.AttrSpec{Name: "queue_timeout", Type: cty.String, Required: false},
+		"run_timeout":              &hcldec.AttrSpec{Name: "run_timeout", Type: cty.String, Required: false},
+		"poll_interval":            &hcldec.AttrSpec{Name: "poll_interval", Type: cty.String, Required: false},
+		"use_websocket":            &hcldec.AttrSpec{Name: "use_websocket", Type: cty.Bool, Required: false},
+		"retry":                    &hcldec.BlockSpec{TypeName: "retry", Nested: hcldec.ObjectSpec((*FlatRetryConfig)(nil).HCL2Spec())},
+		"preflight":                &hcldec.AttrSpec{Name: "preflight", Type: cty.Bool, Required: false},
+		"preflight_module":         &hcldec.AttrSpec{Name: "preflight_module", Type: cty.String, Required: false},
+		"preflight_module_args":    &hcldec.AttrSpec{Name: "preflight_module_args", Type: cty.String, Required: false},
+		"preflight_timeout":        &hcldec.AttrSpec{Name: "preflight_timeout", Type: cty.String, Required: false},
+		"preflight_interval":       &hcldec.AttrSpec{Name: "preflight_interval", Type: cty.String, Required: false},
+		"workflow_template_id":     &hcldec.AttrSpec{Name: "workflow_template_id", Type: cty.Number, Required: false},
+		"project_id":               &hcldec.AttrSpec{Name: "project_id", Type: cty.Number, Required: false},
+		"project_name":             &hcldec.AttrSpec{Name: "project_name", Type: cty.String, Required: false},
+		"playbook":                 &hcldec.AttrSpec{Name: "playbook", Type: cty.String, Required: false},
+		"execution_environment_id": &hcldec.AttrSpec{Name: "execution_environment_id", Type: cty.Number, Required: false},
+		"instance_group_ids":       &hcldec.AttrSpec{Name: "instance_group_ids", Type: cty.List(cty.Number), Required: false},
+		"job_timeout":              &hcldec.AttrSpec{Name: "job_timeout", Type: cty.String, Required: false},
+		"project_update":           &hcldec.AttrSpec{Name: "project_update", Type: cty.Bool, Required: false},
+		"project_update_timeout":   &hcldec.AttrSpec{Name: "project_update_timeout", Type: cty.String, Required: false},
+		"module_name":              &hcldec.AttrSpec{Name: "module_name", Type: cty.String, Required: false},
+		"module_args":              &hcldec.AttrSpec{Name: "module_args", Type: cty.String, Required: false},
+		"become":                   &hcldec.AttrSpec{Name: "become", Type: cty.Bool, Required: false},
+		"verbosity":                &hcldec.AttrSpec{Name: "verbosity", Type: cty.Number, Required: false},
+		"insecure_skip_verify":     &hcldec.AttrSpec{Name: "insecure_skip_verify", Type: cty.Bool, Required: false},
+		"ssh_private_key_file":     &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
+		"ssh_key_passphrase":       &hcldec.AttrSpec{Name: "ssh_key_passphrase", Type: cty.String, Required: false},
+		"ssh_certificate_file":     &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
+		"become_method":            &hcldec.AttrSpec{Name: "become_method", Type: cty.String, Required: false},
+		"become_username":          &hcldec.AttrSpec{Name: "become_username", Type: cty.String, Required: false},
+		"become_password":          &hcldec.AttrSpec{Name: "become_password", Type: cty.String, Required: false},
+		"credential_ids":           &hcldec.AttrSpec{Name: "credential_ids", Type: cty.List(cty.Number), Required: false},
+		"credential_names":         &hcldec.AttrSpec{Name: "credential_names", Type: cty.List(cty.String), Required: false},
+		"vault_password":           &hcldec.AttrSpec{Name: "vault_password", Type: cty.String, Required: false},
+		"vault_id":                 &hcldec.AttrSpec{Name: "vault_id", Type: cty.String, Required: false},
+		"secret_vars":              &hcldec.AttrSpec{Name: "secret_vars", Type: cty.Map(cty.String), Required: false},
+		"secret_vars_injector":     &hcldec.AttrSpec{Name: "secret_vars_injector", Type: cty.String, Required: false},
+		"host_vars":                &hcldec.AttrSpec{Name: "host_vars", Type: cty.Map(cty.String), Required: false},
+		"groups":                   &hcldec.AttrSpec{Name: "groups", Type: cty.List(cty.String), Required: false},
+		"group_vars":               &hcldec.AttrSpec{Name: "group_vars", Type: cty.Map(cty.Map(cty.String)), Required: false},
+		"inventory_vars":           &hcldec.AttrSpec{Name: "inventory_vars", Type: cty.Map(cty.String), Required: false},
+		"additional_host":          &hcldec.BlockListSpec{TypeName: "additional_host", Nested: hcldec.ObjectSpec((*FlatAdditionalHost)(nil).HCL2Spec())},
+		"connection":               &hcldec.AttrSpec{Name: "connection", Type: cty.String, Required: false},
+		"winrm_transport":          &hcldec.AttrSpec{Name: "winrm_transport", Type: cty.String, Required: false},
+		"winrm_use_ntlm":           &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"winrm_use_ssl":            &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
+		"winrm_insecure":           &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
+		"winrm_ca_trust_path":      &hcldec.AttrSpec{Name: "winrm_ca_trust_path", Type: cty.String, Required: false},
+		"winrm_message_encryption": &hcldec.AttrSpec{Name: "winrm_message_encryption", Type: cty.String, Required: false},
+		"winrm_operation_timeout":  &hcldec.AttrSpec{Name: "winrm_operation_timeout", Type: cty.String, Required: false},
+		"winrm_read_timeout":       &hcldec.AttrSpec{Name: "winrm_read_timeout", Type: cty.String, Required: false},
+		"os_type":                  &hcldec.AttrSpec{Name: "os_type", Type: cty.String, Required: false},
+		"windows_shell_type":       &hcldec.AttrSpec{Name: "windows_shell_type", Type: cty.String, Required: false},
+		"host_address_source":      &hcldec.AttrSpec{Name: "host_address_source", Type: cty.String, Required: false},
+		"host_address":             &hcldec.AttrSpec{Name: "host_address", Type: cty.String, Required: false},
+		"host_name":                &hcldec.AttrSpec{Name: "host_name", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatRetryConfig is an auto-generated flat version of RetryConfig.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatRetryConfig struct {
+	MaxAttempts *int     `mapstructure:"max_attempts" cty:"max_attempts" hcl:"max_attempts"`
+	Delay       *string  `mapstructure:"delay" cty:"delay" hcl:"delay"`
+	On          []string `mapstructure:"on" cty:"on" hcl:"on"`
+}
+
+// FlatMapstructure returns a new FlatRetryConfig.
+// FlatRetryConfig is an auto-generated flat version of RetryConfig.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*RetryConfig) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatRetryConfig)
+}
+
+// HCL2Spec returns the hcl spec of a RetryConfig.
+// This spec is used by HCL to read the fields of RetryConfig.
+// The decoded values from this spec will then be applied to a FlatRetryConfig.
+func (*FlatRetryConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"max_attempts": &hcldec.AttrSpec{Name: "max_attempts", Type: cty.Number, Required: false},
+		"delay":        &hcldec.AttrSpec{Name: "delay", Type: cty.String, Required: false},
+		"on":           &hcldec.AttrSpec{Name: "on", Type: cty.List(cty.String), Required: false},
 	}
 	return s
 }
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	packerconfig "github.com/hashicorp/packer-plugin-sdk/template/config"
+
 	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
 )
 
@@ -105,6 +107,428 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "ssh certificate without private key file",
+			config: config.Config{
+				TowerHost:          "https://aap.example.com",
+				Username:           "admin",
+				Password:           "secret",
+				JobTemplateID:      42,
+				OrganizationID:     1,
+				SSHCertificateFile: "id_ed25519-cert.pub",
+			},
+			wantErr: true,
+		},
+		{
+			name: "vault id without vault password",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				Username:       "admin",
+				Password:       "secret",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				VaultID:        "prod",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid secret_vars key",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				Username:       "admin",
+				Password:       "secret",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				SecretVars:     map[string]string{"db-password": "hunter2"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid secret_vars_injector",
+			config: config.Config{
+				TowerHost:          "https://aap.example.com",
+				Username:           "admin",
+				Password:           "secret",
+				JobTemplateID:      42,
+				OrganizationID:     1,
+				SecretVars:         map[string]string{"db_password": "hunter2"},
+				SecretVarsInjector: "file",
+			},
+			wantErr: true,
+		},
+		{
+			name: "implicit group",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				Groups:         []string{"all"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "group_vars for unlisted group",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				Groups:         []string{"webservers"},
+				GroupVars:      map[string]map[string]interface{}{"dbservers": {"port": "5432"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "additional host without name",
+			config: config.Config{
+				TowerHost:       "https://aap.example.com",
+				AccessToken:     "token123",
+				JobTemplateID:   42,
+				OrganizationID:  1,
+				AdditionalHosts: []config.AdditionalHost{{Address: "10.0.0.9"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate additional host",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				AdditionalHosts: []config.AdditionalHost{
+					{Name: "mirror", Address: "10.0.0.9"},
+					{Name: "mirror", Address: "10.0.0.10"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "group_vars for additional host group",
+			config: config.Config{
+				TowerHost:       "https://aap.example.com",
+				AccessToken:     "token123",
+				JobTemplateID:   42,
+				OrganizationID:  1,
+				AdditionalHosts: []config.AdditionalHost{{Name: "localhost", Groups: []string{"helpers"}}},
+				GroupVars:       map[string]map[string]interface{}{"helpers": {"role": "mirror"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid connection",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				Connection:     "psrp",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid winrm transport",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				WinRMTransport: "digest",
+			},
+			wantErr: true,
+		},
+		{
+			name: "winrm_use_ntlm with another transport",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				WinRMUseNTLM:   true,
+				WinRMTransport: "kerberos",
+			},
+			wantErr: true,
+		},
+		{
+			name: "winrm ca trust path with insecure",
+			config: config.Config{
+				TowerHost:        "https://aap.example.com",
+				AccessToken:      "token123",
+				JobTemplateID:    42,
+				OrganizationID:   1,
+				WinRMCATrustPath: "/etc/ssl/ca.pem",
+				WinRMInsecure:    packerconfig.TriTrue,
+			},
+			wantErr: true,
+		},
+		{
+			name: "winrm read timeout not above operation timeout",
+			config: config.Config{
+				TowerHost:             "https://aap.example.com",
+				AccessToken:           "token123",
+				JobTemplateID:         42,
+				OrganizationID:        1,
+				WinRMOperationTimeout: time.Minute,
+				WinRMReadTimeout:      30 * time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid windows shell type",
+			config: config.Config{
+				TowerHost:        "https://aap.example.com",
+				AccessToken:      "token123",
+				JobTemplateID:    42,
+				OrganizationID:   1,
+				OSType:           "windows",
+				WindowsShellType: "bash",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid host_address_source",
+			config: config.Config{
+				TowerHost:         "https://aap.example.com",
+				AccessToken:       "token123",
+				JobTemplateID:     42,
+				OrganizationID:    1,
+				HostAddressSource: "ipv6",
+			},
+			wantErr: true,
+		},
+		{
+			name: "host_address with host_address_source",
+			config: config.Config{
+				TowerHost:         "https://aap.example.com",
+				AccessToken:       "token123",
+				JobTemplateID:     42,
+				OrganizationID:    1,
+				HostAddressSource: "private_ip",
+				HostAddress:       "{{ .PrivateIP }}",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative queue_timeout",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				QueueTimeout:   -time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "run_timeout above the default timeout",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				RunTimeout:     45 * time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "run_timeout within a raised timeout",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				Timeout:        time.Hour,
+				RunTimeout:     45 * time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown retry outcome",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				Retry:          config.RetryConfig{MaxAttempts: 3, On: []string{"timeout"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "retry with workflow template",
+			config: config.Config{
+				TowerHost:          "https://aap.example.com",
+				AccessToken:        "token123",
+				WorkflowTemplateID: 42,
+				OrganizationID:     1,
+				Retry:              config.RetryConfig{MaxAttempts: 3},
+			},
+			wantErr: true,
+		},
+		{
+			name: "preflight without machine credential",
+			config: config.Config{
+				TowerHost:          "https://aap.example.com",
+				AccessToken:        "token123",
+				WorkflowTemplateID: 42,
+				OrganizationID:     1,
+				CreateCredential:   packerconfig.TriFalse,
+				Preflight:          true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "preflight of an ad hoc command with credential_ids",
+			config: config.Config{
+				TowerHost:        "https://aap.example.com",
+				AccessToken:      "token123",
+				OrganizationID:   1,
+				ModuleName:       "ansible.builtin.ping",
+				CreateCredential: packerconfig.TriFalse,
+				CredentialIDs:    []int{7},
+				Preflight:        true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "preflight of a playbook with credential_names",
+			config: config.Config{
+				TowerHost:        "https://aap.example.com",
+				AccessToken:      "token123",
+				OrganizationID:   1,
+				ProjectName:      "playbooks",
+				Playbook:         "site.yml",
+				CreateCredential: packerconfig.TriFalse,
+				CredentialNames:  []string{"build machine"},
+				Preflight:        true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid ad hoc command",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				OrganizationID: 1,
+				ModuleName:     "ansible.builtin.package",
+				ModuleArgs:     "name=nginx state=present",
+				Become:         true,
+				Verbosity:      2,
+			},
+			wantErr: false,
+		},
+		{
+			name: "ad hoc command with job template",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				ModuleName:     "ansible.builtin.ping",
+			},
+			wantErr: true,
+		},
+		{
+			name: "ad hoc command with vault password",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				OrganizationID: 1,
+				ModuleName:     "ansible.builtin.ping",
+				VaultPassword:  "secret",
+			},
+			wantErr: true,
+		},
+		{
+			name: "verbosity out of range",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				OrganizationID: 1,
+				ModuleName:     "ansible.builtin.ping",
+				Verbosity:      6,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid playbook",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				OrganizationID: 1,
+				ProjectName:    "playbooks",
+				Playbook:       "site.yml",
+				JobTimeout:     time.Hour,
+			},
+			wantErr: false,
+		},
+		{
+			name: "playbook without project",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				OrganizationID: 1,
+				Playbook:       "site.yml",
+			},
+			wantErr: true,
+		},
+		{
+			name: "playbook with job template",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				ProjectID:      9,
+				Playbook:       "site.yml",
+			},
+			wantErr: true,
+		},
+		{
+			name: "project without playbook",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				ProjectID:      9,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid project update",
+			config: config.Config{
+				TowerHost:      "https://aap.example.com",
+				AccessToken:    "token123",
+				JobTemplateID:  42,
+				OrganizationID: 1,
+				ProjectUpdate:  true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "project update with workflow template",
+			config: config.Config{
+				TowerHost:          "https://aap.example.com",
+				AccessToken:        "token123",
+				WorkflowTemplateID: 42,
+				OrganizationID:     1,
+				ProjectUpdate:      true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative project update timeout",
+			config: config.Config{
+				TowerHost:            "https://aap.example.com",
+				AccessToken:          "token123",
+				JobTemplateID:        42,
+				OrganizationID:       1,
+				ProjectUpdate:        true,
+				ProjectUpdateTimeout: -time.Minute,
+			},
+			wantErr: true,
+		},
 		{
 			name: "valid workflow template",
 			config: config.Config{
@@ -151,11 +575,66 @@ func TestConfig_Validate_Defaults(t *testing.T) {
 		t.Errorf("Expected default poll interval to be 10s, got %v", config.PollInterval)
 	}
 
+	if config.QueueTimeout != 0 || config.RunTimeout != 0 {
+		t.Errorf("Expected queue and run timeouts to be bounded only by the timeout, got %v and %v", config.QueueTimeout, config.RunTimeout)
+	}
+
 	if config.ExtraVars == nil {
 		t.Error("Expected ExtraVars to be initialized as empty map")
 	}
 }
 
+func TestConfig_Validate_CreateCredential(t *testing.T) {
+	tests := []struct {
+		name  string
+		value packerconfig.Trilean
+		want  packerconfig.Trilean
+	}{
+		{name: "unset defaults to true", value: packerconfig.TriUnset, want: packerconfig.TriTrue},
+		{name: "explicit true", value: packerconfig.TriTrue, want: packerconfig.TriTrue},
+		{name: "explicit false is kept", value: packerconfig.TriFalse, want: packerconfig.TriFalse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.Config{
+				TowerHost:        "https://aap.example.com",
+				AccessToken:      "token123",
+				JobTemplateID:    42,
+				OrganizationID:   1,
+				CreateCredential: tt.value,
+			}
+			if err := c.Validate(); err != nil {
+				t.Fatalf("Config.Validate() failed: %v", err)
+			}
+			if c.CreateCredential != tt.want {
+				t.Errorf("Expected create_credential %s, got %s", tt.want.ToString(), c.CreateCredential.ToString())
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_RetryDefaults(t *testing.T) {
+	config := config.Config{
+		TowerHost:      "https://aap.example.com",
+		AccessToken:    "token123",
+		JobTemplateID:  42,
+		OrganizationID: 1,
+		Retry:          config.RetryConfig{MaxAttempts: 3},
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Config.Validate() failed: %v", err)
+	}
+
+	if config.Retry.Delay != 30*time.Second {
+		t.Errorf("Expected default retry delay to be 30s, got %v", config.Retry.Delay)
+	}
+	if len(config.Retry.On) != 1 || config.Retry.On[0] != "unreachable" {
+		t.Errorf("Expected retries on unreachable hosts by default, got %v", config.Retry.On)
+	}
+}
+
 func TestConfig_Validate_CustomDefaults(t *testing.T) {
 	config := config.Config{
 		TowerHost:      "https://aap.example.com",
@@ -188,3 +667,19 @@ func TestConfig_Validate_CustomDefaults(t *testing.T) {
 		t.Errorf("Expected custom extra vars to be preserved")
 	}
 }
+
+func TestConfig_Validate_WinRMReadTimeout(t *testing.T) {
+	c := config.Config{
+		TowerHost:             "https://aap.example.com",
+		AccessToken:           "token123",
+		JobTemplateID:         42,
+		OrganizationID:        1,
+		WinRMOperationTimeout: time.Minute,
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Config.Validate() failed: %v", err)
+	}
+	if c.WinRMReadTimeout != 70*time.Second {
+		t.Errorf("Expected read timeout to default to 70s, got %v", c.WinRMReadTimeout)
+	}
+}
@@ -0,0 +1,98 @@
+// Package jobclock times controller jobs against their queue, run and
+// overall timeouts. The client and its in-memory fake share it so that both
+// time jobs out the same way.
+package jobclock
+
+import "time"
+
+// Queued reports whether a job status means the job has not started yet.
+func Queued(status string) bool {
+	switch status {
+	case "", "new", "pending", "waiting":
+		return true
+	}
+	return false
+}
+
+// Limits are the timeouts a job is held to. A zero limit does not apply.
+type Limits struct {
+	// Overall bounds the job from launch, queued and running together.
+	Overall time.Duration
+	Queue   time.Duration
+	Run     time.Duration
+}
+
+// Expiry describes a timeout that expired.
+type Expiry struct {
+	// Limit is the configured timeout that expired.
+	Limit time.Duration
+	// Overall reports whether Limit is the overall timeout.
+	Overall bool
+	// Started reports whether the job left the queue.
+	Started bool
+	// Status is the job's last known status.
+	Status string
+}
+
+// Clock tracks how long a job has been queued and running.
+type Clock struct {
+	limits Limits
+	start  time.Time
+	// running is when the job was first seen out of the queue.
+	running time.Time
+	status  string
+}
+
+// New starts timing a job now.
+func New(limits Limits) *Clock {
+	return &Clock{limits: limits, start: time.Now()}
+}
+
+// Observe records the job's latest status.
+func (k *Clock) Observe(status string) {
+	k.status = status
+	if k.running.IsZero() && !Queued(status) {
+		k.running = time.Now()
+	}
+}
+
+// Deadline returns when the job times out in its current phase, or the zero
+// time if no timeout applies.
+func (k *Clock) Deadline() time.Time {
+	deadline, _, _ := k.bound()
+	return deadline
+}
+
+// bound returns the earliest deadline of the job's current phase together
+// with the configured timeout that sets it.
+func (k *Clock) bound() (deadline time.Time, limit time.Duration, overall bool) {
+	earliest := func(t time.Time, d time.Duration, all bool) {
+		if deadline.IsZero() || t.Before(deadline) {
+			deadline, limit, overall = t, d, all
+		}
+	}
+	if k.limits.Overall > 0 {
+		earliest(k.start.Add(k.limits.Overall), k.limits.Overall, true)
+	}
+	if k.running.IsZero() && k.limits.Queue > 0 {
+		earliest(k.start.Add(k.limits.Queue), k.limits.Queue, false)
+	}
+	if !k.running.IsZero() && k.limits.Run > 0 {
+		earliest(k.running.Add(k.limits.Run), k.limits.Run, false)
+	}
+	return deadline, limit, overall
+}
+
+// Expired reports whether the deadline has passed and, if so, which
+// timeout expired.
+func (k *Clock) Expired() (Expiry, bool) {
+	deadline, limit, overall := k.bound()
+	if deadline.IsZero() || time.Now().Before(deadline) {
+		return Expiry{}, false
+	}
+	status := k.status
+	if status == "" {
+		status = "pending"
+	}
+	return Expiry{Limit: limit, Overall: overall, Started: !k.running.IsZero(), Status: status}, true
+}
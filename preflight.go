@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+// preflight runs a ping ad hoc command against the build host until it
+// succeeds, so that the job does not start while the host is still booting
+// or lacks the Python interpreter Ansible needs.
+func (p *Provisioner) preflight(ctx context.Context, ui packersdk.Ui, inventoryID, credentialID int, limit string, windows bool) error {
+	module := p.config.PreflightModule
+	if module == "" {
+		module = "ansible.builtin.ping"
+		if windows {
+			module = "ansible.windows.win_ping"
+		}
+	}
+	ui.Message(fmt.Sprintf("🩺 Waiting up to %s for %s to respond to %s...", p.config.PreflightTimeout, limit, module))
+
+	deadline := time.Now().Add(p.config.PreflightTimeout)
+	for attempt := 1; ; attempt++ {
+		commandID, err := p.client.LaunchAdHocCommand(ctx, client.AdHocCommand{
+			InventoryID:  inventoryID,
+			CredentialID: credentialID,
+			ModuleName:   module,
+			ModuleArgs:   p.config.PreflightModuleArgs,
+			Limit:        limit,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to launch preflight command: %w", err)
+		}
+
+		// The reason a host failed is only in the command's events.
+		var reason string
+		err = p.client.PollAdHocCommand(ctx, commandID, client.PollOptions{
+			Timeout:      time.Until(deadline),
+			PollInterval: p.config.PollInterval,
+			Websocket:    p.config.UseWebsocket,
+			OnEvent: func(e client.JobEvent) {
+				if !failure(e) {
+					return
+				}
+				if msg, ok := e.Result()["msg"]; ok {
+					reason = excerpt(fmt.Sprint(msg))
+				}
+			},
+		})
+		if err == nil {
+			ui.Message(fmt.Sprintf("✅ %s responded to %s (attempt %d)", limit, module, attempt))
+			return nil
+		}
+
+		var failed *client.JobFailedError
+		if !errors.As(err, &failed) || failed.Outcome == client.OutcomeCanceled {
+			return fmt.Errorf("preflight command %d: %w", commandID, err)
+		}
+		if reason != "" {
+			err = fmt.Errorf("%w: %s", err, reason)
+		}
+		if time.Now().Add(p.config.PreflightInterval).After(deadline) {
+			return fmt.Errorf("%s did not respond to %s within %s: %w", limit, module, p.config.PreflightTimeout, err)
+		}
+		ui.Message(fmt.Sprintf("⏳ Preflight attempt %d: %s; retrying in %s", attempt, describeError(err), p.config.PreflightInterval))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.config.PreflightInterval):
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+
+	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
+)
+
+// updateProject syncs the project of a job template from SCM before the
+// job is launched, and reports the revision the job will run so that the
+// image can be traced back to a playbook commit.
+func (p *Provisioner) updateProject(ctx context.Context, ui packersdk.Ui, jobTemplateID int) error {
+	projectID, err := p.client.GetJobTemplateProject(ctx, jobTemplateID)
+	if err != nil {
+		return err
+	}
+
+	ui.Message(fmt.Sprintf("🔄 Updating project %d from SCM...", projectID))
+	updateID, err := p.client.UpdateProject(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	ui.Message(fmt.Sprintf("⏳ Waiting up to %s for project update %s", p.config.ProjectUpdateTimeout, p.jobURL("project", updateID)))
+
+	err = p.client.PollProjectUpdate(ctx, updateID, client.PollOptions{
+		Timeout:      p.config.ProjectUpdateTimeout,
+		PollInterval: p.config.PollInterval,
+		Websocket:    p.config.UseWebsocket,
+	})
+	var failed *client.JobFailedError
+	if errors.As(err, &failed) {
+		// The update's output shows why git or the requirements install
+		// failed, which the status alone does not.
+		ui.Message("📋 Project update output:")
+		output := &jobOutput{ui: ui}
+		output.stdout(p.client.GetProjectUpdateStdout(ctx, updateID))
+		ui.Message(fmt.Sprintf("🔗 %s", p.jobURL("project", updateID)))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// The project reports whichever update finished last, which may not be
+	// ours, so the revision comes from the update itself.
+	update, err := p.client.GetProjectUpdate(ctx, updateID)
+	if err != nil {
+		return err
+	}
+	project, err := p.client.GetProject(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	revision := update.ScmRevision
+	if revision == "" {
+		revision = "unknown"
+	}
+	branch := update.ScmBranch
+	if branch == "" {
+		branch = project.ScmBranch
+	}
+	if branch == "" {
+		branch = "default branch"
+	}
+	ui.Message(fmt.Sprintf("📌 Project %s (ID %d) synced to revision %s of %s", project.Name, projectID, revision, branch))
+	return nil
+}
@@ -1,9 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/client"
 	"github.com/rptcloud/packer-provisioner-ansible-aap/pkgs/config"
@@ -12,6 +21,7 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
 	sdkconfig "github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/hashicorp/packer-plugin-sdk/version"
 )
 
@@ -19,15 +29,25 @@ var pluginVersion = "1.0.0" // overridden by goreleaser
 
 type Provisioner struct {
 	config config.Config
-	client *client.AAPClient
+	client client.API
 }
 
 // Resource IDs for cleanup.
 type ResourceIDs struct {
-	InventoryID  int
-	HostID       int
-	CredentialID int
-	JobID        int
+	InventoryID       int
+	HostID            int
+	AdditionalHostIDs []int
+	GroupIDs          map[string]int
+	CredentialID      int
+	VaultCredentialID int
+	JobTemplateID     int
+	JobID             int
+
+	SecretCredentialID     int
+	SecretCredentialTypeID int
+	// SecretCredentialTypeCreated is set when this run registered the secret
+	// vars credential type rather than reusing an existing one.
+	SecretCredentialTypeCreated bool
 }
 
 func main() {
@@ -51,6 +71,10 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 	if err := sdkconfig.Decode(&p.config, &sdkconfig.DecodeOpts{
 		PluginType:  "provisioner",
 		Interpolate: true,
+		// host_address is rendered over the generated data in Provision.
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"host_address"},
+		},
 	}, raws...); err != nil {
 		return err
 	}
@@ -75,9 +99,10 @@ func (p *Provisioner) Provision(
 	defer p.cleanup(ctx, ui, resources)
 
 	// Extract connection details from generated data
-	host := "localhost"
-	if h, ok := generatedData["Host"].(string); ok && h != "" {
-		host = h
+	host, err := p.hostAddress(generatedData)
+	if err != nil {
+		ui.Error(fmt.Sprintf("❌ %s", err))
+		return err
 	}
 
 	port := 22
@@ -90,11 +115,19 @@ func (p *Provisioner) Provision(
 		username = u
 	}
 
-	// If we have WinRM password but port is still 22, we need to use WinRM port
-	if winRMPass, hasWinRMPass := generatedData["WinRMPassword"].(string); hasWinRMPass && winRMPass != "" && port == 22 {
+	connection := p.connectionType(generatedData)
+
+	// Older Packer versions report neither ConnType nor the WinRM port
+	if connection == "winrm" && port == 22 {
 		port = 5985 // Override to WinRM HTTP port
 		ui.Message(fmt.Sprintf("🔧 Detected WinRM connection, but port detected as 22, overriding port to %d", port))
 	}
+	ui.Message(fmt.Sprintf("🔌 Using %s connection to %s", connection, net.JoinHostPort(host, strconv.Itoa(port))))
+
+	var shellType string
+	if connection == "ssh" {
+		shellType = p.windowsShellType(ctx, ui, comm)
+	}
 
 	// Initialize client if not already done
 	ui.Message(fmt.Sprintf("🌐 Attempting to connect to AAP server: %s", p.config.TowerHost))
@@ -109,128 +142,818 @@ func (p *Provisioner) Provision(
 	} else {
 		ui.Message("✅ AAP client already initialized")
 	}
+	ui.Message(fmt.Sprintf("🏷️ Temporary resources are tagged with run marker: %s", p.client.RunMarker()))
+
+	// The template's credentials are fetched once: they tell which machine
+	// credential to rely on and are merged with the launch credentials.
+	var templateCreds []client.Credential
+	if p.config.JobTemplateID != 0 {
+		templateCreds, err = p.client.GetTemplateCredentials(ctx, p.config.JobTemplateID)
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to fetch template credentials: %s", describeError(err)))
+			return fmt.Errorf("failed to fetch template credentials: %w", err)
+		}
+	}
+
+	// With create_credential = false the template's machine credential
+	// authenticates to the host, including for the preflight.
+	var credentialID int
+	if p.config.CreateCredential.False() {
+		credentialID, err = p.checkMachineCredential(ctx, ui, templateCreds)
+		if err != nil {
+			ui.Error(fmt.Sprintf("❌ %s", describeError(err)))
+			return err
+		}
+	}
 
 	// Create inventory
 	ui.Message(fmt.Sprintf("🎯 Creating inventory for target host: %s", host))
 	ui.Message(fmt.Sprintf("🗄️ Using organization ID: %d", p.config.OrganizationID))
 	inventoryID, err := p.client.CreateInventory(ctx, p.config.OrganizationID)
 	if err != nil {
-		ui.Error(fmt.Sprintf("❌ Failed to create inventory: %s", err))
-		ui.Error(fmt.Sprintf("🔍 This might be a network connectivity issue to %s", p.config.TowerHost))
-		return fmt.Errorf("failed to create inventory: %s", err)
+		ui.Error(fmt.Sprintf("❌ Failed to create inventory: %s", describeError(err)))
+		var apiErr *client.APIError
+		if !errors.As(err, &apiErr) {
+			ui.Error(fmt.Sprintf("🔍 This might be a network connectivity issue to %s", p.config.TowerHost))
+		}
+		return fmt.Errorf("failed to create inventory: %w", err)
 	}
 	resources.InventoryID = inventoryID
 	ui.Message(fmt.Sprintf("✅ Created inventory with ID: %d", inventoryID))
 
+	if len(p.config.InventoryVars) > 0 {
+		if err := p.client.UpdateInventoryVariables(ctx, inventoryID, p.config.InventoryVars); err != nil {
+			ui.Error(fmt.Sprintf("failed to set inventory variables: %s", describeError(err)))
+			return fmt.Errorf("failed to set inventory variables: %w", err)
+		}
+	}
+
 	// Create credential if needed
-	// User might not want to create a credential because they set ask_credential_on_launch to false
-	var credentialID int
-	var credentialType string
-	if p.config.CreateCredential {
-		// Windows should go first because its possible to have both SSH and WinRM credentials
-		if winrmPassword, ok := generatedData["WinRMPassword"].(string); ok && winrmPassword != "" {
-			// Create WinRM credential with password
-			ui.Message("🔑 Creating WinRM credential with password...")
-			credentialID, err = p.client.CreateWinRMCredential(ctx, p.config.OrganizationID, username, winrmPassword)
-			if err != nil {
-				ui.Error(fmt.Sprintf("failed to create WinRM credential: %s", err))
-				return fmt.Errorf("failed to create WinRM credential: %s", err)
-			}
-			resources.CredentialID = credentialID
-			credentialType = "winrm_password"
-			ui.Message(fmt.Sprintf("✅ Created WinRM credential ID: %d", credentialID))
-		} else if privateKey, ok := generatedData["SSHPrivateKey"].(string); ok && privateKey != "" {
-			// Create SSH credential with private key
-			credentialID, err = p.client.CreateCredential(ctx, p.config.OrganizationID, username, privateKey)
-			if err != nil {
-				ui.Error(fmt.Sprintf("failed to create SSH credential: %s", err))
-				return fmt.Errorf("failed to create SSH credential: %s", err)
-			}
-			resources.CredentialID = credentialID
-			credentialType = "ssh_key"
-			ui.Message(fmt.Sprintf("✅ Created SSH credential ID: %d", credentialID))
-		} else if password, ok := generatedData["Password"].(string); ok && password != "" {
-			// Create SSH credential with password
-			ui.Message("🔑 Creating SSH credential with password...")
-			credentialID, err = p.client.CreatePasswordCredential(ctx, p.config.OrganizationID, username, password)
-			if err != nil {
-				ui.Error(fmt.Sprintf("failed to create password credential: %s", err))
-				return fmt.Errorf("failed to create password credential: %s", err)
-			}
-			resources.CredentialID = credentialID
-			credentialType = "ssh_password"
-			ui.Message(fmt.Sprintf("✅ Created password credential ID: %d", credentialID))
-		} else {
-			ui.Error("❌ No authentication method found in generated data (SSHPrivateKey, Password, or WinRMPassword)")
-			return fmt.Errorf("no authentication method found in generated data")
+	if p.config.CreateCredential.True() {
+		cred, credentialType, err := p.machineCredential(username, connection, generatedData)
+		if err != nil {
+			ui.Error(fmt.Sprintf("❌ %s", err))
+			return err
+		}
+
+		ui.Message(fmt.Sprintf("🔑 Creating %s credential...", credentialLabels[credentialType]))
+		credentialID, err = p.client.CreateMachineCredential(ctx, p.config.OrganizationID, cred)
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to create %s credential: %s", credentialLabels[credentialType], describeError(err)))
+			return fmt.Errorf("failed to create %s credential: %w", credentialLabels[credentialType], err)
+		}
+		resources.CredentialID = credentialID
+		ui.Message(fmt.Sprintf("✅ Created %s credential ID: %d", credentialLabels[credentialType], credentialID))
+	}
+
+	if p.config.VaultPassword != "" {
+		ui.Message("🔑 Creating Vault credential...")
+		vaultCredentialID, err := p.client.CreateVaultCredential(ctx, p.config.OrganizationID, p.config.VaultPassword, p.config.VaultID)
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to create Vault credential: %s", describeError(err)))
+			return fmt.Errorf("failed to create Vault credential: %w", err)
+		}
+		resources.VaultCredentialID = vaultCredentialID
+		ui.Message(fmt.Sprintf("✅ Created Vault credential ID: %d", vaultCredentialID))
+	}
+
+	if len(p.config.SecretVars) > 0 {
+		if err := p.createSecretVarsCredential(ctx, ui, resources); err != nil {
+			ui.Error(fmt.Sprintf("failed to create secret vars credential: %s", describeError(err)))
+			return fmt.Errorf("failed to create secret vars credential: %w", err)
 		}
 	}
 
 	// Add host to inventory
 	ui.Message(fmt.Sprintf("🖥️ Adding host %s to inventory", host))
-	hostID, err := p.client.CreateHost(ctx, inventoryID, client.HostDetails{
-		Host:     host,
-		Port:     port,
-		Username: username,
-	}, credentialType)
+	hostDetails := client.HostDetails{
+		Name:         p.config.HostName,
+		Host:         host,
+		Port:         port,
+		Username:     username,
+		Connection:   connection,
+		ShellType:    shellType,
+		WinRM:        p.winrmOptions(),
+		BecomeMethod: p.config.BecomeMethod,
+		BecomeUser:   p.config.BecomeUsername,
+		Vars:         p.config.HostVars,
+	}
+	hostID, err := p.client.CreateHost(ctx, inventoryID, hostDetails)
 	if err != nil {
-		ui.Error(fmt.Sprintf("failed to add host: %s", err))
-		return fmt.Errorf("failed to add host: %s", err)
+		ui.Error(fmt.Sprintf("failed to add host: %s", describeError(err)))
+		return fmt.Errorf("failed to add host: %w", err)
 	}
 	resources.HostID = hostID
 	ui.Message(fmt.Sprintf("✅ Added host ID: %d", hostID))
 
-	// Launch job
-	ui.Message(fmt.Sprintf("🚀 Launching job template ID %d for target_host=%s", p.config.JobTemplateID, host))
+	if err := p.addToGroups(ctx, ui, resources, hostID, p.config.Groups); err != nil {
+		ui.Error(fmt.Sprintf("failed to add host to groups: %s", describeError(err)))
+		return fmt.Errorf("failed to add host to groups: %w", err)
+	}
+
+	for _, extra := range p.config.AdditionalHosts {
+		if err := p.createAdditionalHost(ctx, ui, resources, extra); err != nil {
+			ui.Error(fmt.Sprintf("failed to add additional host %s: %s", extra.Name, describeError(err)))
+			return fmt.Errorf("failed to add additional host %s: %w", extra.Name, err)
+		}
+	}
+
+	if p.config.Preflight {
+		windows := connection == "winrm" || shellType != ""
+		if err := p.preflight(ctx, ui, inventoryID, credentialID, hostDetails.InventoryName(), windows); err != nil {
+			ui.Error(fmt.Sprintf("❌ %s", describeError(err)))
+			return err
+		}
+	}
+
+	if p.config.ModuleName != "" {
+		return p.runAdHocCommand(ctx, ui, inventoryID, credentialID, host)
+	}
 
-	jobID, err := p.client.LaunchJob(ctx, inventoryID, p.config.JobTemplateID, 0, credentialID, p.config.ExtraVars)
+	jobTemplateID := p.config.JobTemplateID
+	if p.config.Playbook != "" {
+		if err := p.createJobTemplate(ctx, ui, resources); err != nil {
+			ui.Error(fmt.Sprintf("failed to create job template: %s", describeError(err)))
+			return fmt.Errorf("failed to create job template: %w", err)
+		}
+		jobTemplateID = resources.JobTemplateID
+	}
+	if p.config.ProjectUpdate {
+		if err := p.updateProject(ctx, ui, jobTemplateID); err != nil {
+			ui.Error(fmt.Sprintf("failed to update project: %s", describeError(err)))
+			return fmt.Errorf("failed to update project: %w", err)
+		}
+	}
+
+	// Launch job; job_template_id takes precedence over workflow_template_id
+	workflowTemplateID := 0
+	if jobTemplateID == 0 {
+		workflowTemplateID = p.config.WorkflowTemplateID
+		ui.Message(fmt.Sprintf("🚀 Launching workflow template ID %d for target_host=%s", workflowTemplateID, host))
+	} else {
+		ui.Message(fmt.Sprintf("🚀 Launching job template ID %d for target_host=%s", jobTemplateID, host))
+	}
+
+	launchCredentialIDs, err := p.launchCredentials(ctx, ui, resources, templateCreds)
 	if err != nil {
-		ui.Error(fmt.Sprintf("failed to launch job: %s", err))
-		return fmt.Errorf("failed to launch job: %s", err)
+		ui.Error(fmt.Sprintf("failed to resolve launch credentials: %s", describeError(err)))
+		return fmt.Errorf("failed to resolve launch credentials: %w", err)
+	}
+
+	jobID, err := p.client.LaunchJob(ctx, inventoryID, jobTemplateID, workflowTemplateID, launchCredentialIDs, p.config.ExtraVars)
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to launch job: %s", describeError(err)))
+		return fmt.Errorf("failed to launch job: %w", err)
 	}
 	resources.JobID = jobID
-	ui.Message(fmt.Sprintf("✅ Job launched %s/execution/jobs/playbook/%d/output/. Waiting for completion...", p.config.TowerHost, jobID))
-	defer func() {
-		stdout, err := p.client.GetJobStdout(ctx, jobID)
+	if workflowTemplateID != 0 {
+		ui.Message(fmt.Sprintf("✅ Workflow job launched %s. Waiting for completion...", p.jobURL("workflow", jobID)))
+	} else {
+		ui.Message(fmt.Sprintf("✅ Job launched %s. Waiting for completion...", p.jobURL("playbook", jobID)))
+	}
+
+	// Poll job status, printing the job's output as it runs. Job templates
+	// are relaunched when they fail in a way the retry settings cover.
+	var attempts []jobAttempt
+	for {
+		err = p.waitForJob(ctx, ui, jobID, workflowTemplateID != 0)
+		var failed *client.JobFailedError
+		if !errors.As(err, &failed) || !p.retryable(failed, len(attempts)+1) {
+			break
+		}
+
+		task := p.explainFailure(ctx, ui, failed)
+		attempts = append(attempts, jobAttempt{JobID: jobID, Outcome: failed.Outcome, Task: task})
+		hosts := "failed"
+		if failed.Outcome == client.OutcomeError {
+			// A job in error may not have reached any host.
+			hosts = "all"
+		}
+		ui.Message(fmt.Sprintf("♻️ %s; relaunching on %s hosts in %s (attempt %d of %d)",
+			describeError(failureError(failed, task)), hosts, p.config.Retry.Delay, len(attempts)+1, p.config.Retry.MaxAttempts))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.config.Retry.Delay):
+		}
+
+		relaunchedID, err := p.client.RelaunchJob(ctx, jobID, hosts)
 		if err != nil {
-			ui.Message(fmt.Sprintf("⚠️ %s", err))
-		} else {
-			ui.Message(stdout)
+			ui.Error(fmt.Sprintf("failed to relaunch job: %s", describeError(err)))
+			return fmt.Errorf("failed to relaunch job: %w", err)
 		}
-	}()
+		jobID = relaunchedID
+		resources.JobID = jobID
+		ui.Message(fmt.Sprintf("✅ Job relaunched %s. Waiting for completion...", p.jobURL("playbook", jobID)))
+	}
 
-	// Poll job status
-	ui.Message("⏳ Polling job status...")
-	err = p.client.PollJob(ctx, jobID, p.config.Timeout, p.config.PollInterval)
+	var failed *client.JobFailedError
+	if errors.As(err, &failed) {
+		return p.jobFailed(ctx, ui, failed, attempts)
+	}
+	var timedOut *client.JobTimeoutError
+	if errors.As(err, &timedOut) {
+		ui.Error(fmt.Sprintf("⏰ %s; the job was left on the controller", describeError(err)))
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("job failed: %s", err)
+		ui.Error(fmt.Sprintf("❌ %s", describeError(err)))
+		return fmt.Errorf("job failed: %w", err)
 	}
 
+	if len(attempts) > 0 {
+		reportAttempts(ui, append(attempts, jobAttempt{JobID: jobID, Outcome: client.OutcomeSuccessful}))
+	}
 	ui.Message("🎉 Job completed successfully!")
 	return nil
 }
 
+// waitForJob polls a launched job until it finishes, printing its output.
+func (p *Provisioner) waitForJob(ctx context.Context, ui packersdk.Ui, jobID int, workflow bool) error {
+	ui.Message("⏳ Polling job status...")
+	output := &jobOutput{ui: ui}
+	opts := p.pollOptions(ui, output)
+	if workflow {
+		return p.client.PollWorkflowJob(ctx, jobID, opts)
+	}
+
+	err := p.client.PollJob(ctx, jobID, opts)
+	if output.printed == 0 {
+		// Controllers that do not keep job events still have the stdout.
+		output.stdout(p.client.GetJobStdout(ctx, jobID))
+	}
+	return err
+}
+
+// pollOptions streams a job's progress to output.
+func (p *Provisioner) pollOptions(ui packersdk.Ui, output *jobOutput) client.PollOptions {
+	return client.PollOptions{
+		Timeout:      p.config.Timeout,
+		QueueTimeout: p.config.QueueTimeout,
+		RunTimeout:   p.config.RunTimeout,
+		PollInterval: p.config.PollInterval,
+		OnQueue:      output.queue,
+		OnEvent:      output.event,
+		OnJob:        output.job,
+		Websocket:    p.config.UseWebsocket,
+		OnFallback: func(err error) {
+			ui.Message(fmt.Sprintf("⚠️ Websocket unavailable, polling every %s instead: %s", p.config.PollInterval, describeError(err)))
+		},
+	}
+}
+
+// retryable reports whether a job that failed on the given attempt should
+// be relaunched.
+func (p *Provisioner) retryable(failed *client.JobFailedError, attempt int) bool {
+	if failed.Kind == client.KindWorkflowJob || attempt >= p.config.Retry.MaxAttempts {
+		return false
+	}
+	return slices.Contains(p.config.Retry.On, string(failed.Outcome))
+}
+
+// jobFailed reports a job that finished without succeeding, along with any
+// earlier attempts. The returned error keeps the outcome, so callers can
+// tell playbook failures from infrastructure errors with errors.Is.
+func (p *Provisioner) jobFailed(ctx context.Context, ui packersdk.Ui, failed *client.JobFailedError, attempts []jobAttempt) error {
+	task := p.explainFailure(ctx, ui, failed)
+	err := failureError(failed, task)
+	if len(attempts) > 0 {
+		attempts = append(attempts, jobAttempt{JobID: failed.JobID, Outcome: failed.Outcome, Task: task})
+		reportAttempts(ui, attempts)
+		err = fmt.Errorf("%w (after %d attempts)", err, len(attempts))
+	}
+	ui.Error(fmt.Sprintf("❌ %s", describeError(err)))
+	return err
+}
+
+// explainFailure prints what is known about why a job did not succeed and
+// returns its first failed task, if any.
+func (p *Provisioner) explainFailure(ctx context.Context, ui packersdk.Ui, failed *client.JobFailedError) *client.JobEvent {
+	switch failed.Outcome {
+	case client.OutcomeFailed, client.OutcomeUnreachable:
+		if failed.Kind != client.KindWorkflowJob {
+			return p.reportFailure(ctx, ui, failed.JobID)
+		}
+	case client.OutcomeError:
+		ui.Message("ℹ️ The controller could not run the job; check the project, inventory and execution environment")
+	case client.OutcomeCanceled:
+		ui.Message("ℹ️ The job was canceled on the controller")
+	}
+	return nil
+}
+
+// failureError names the task a job failed at, when known.
+func failureError(failed *client.JobFailedError, task *client.JobEvent) error {
+	if task == nil {
+		return failed
+	}
+	return fmt.Errorf("%w at task %q on %s", failed, task.Task, task.Host)
+}
+
+// credentialLabels describes each credential type in UI messages.
+var credentialLabels = map[string]string{
+	"winrm_password": "WinRM password",
+	"ssh_key":        "SSH key",
+	"ssh_password":   "SSH password",
+}
+
+// hostAddress returns the address AAP connects to: host_address rendered
+// over the generated data, or the generated data entry named by
+// host_address_source.
+func (p *Provisioner) hostAddress(generatedData map[string]interface{}) (string, error) {
+	if p.config.HostAddress != "" {
+		address, err := interpolate.Render(p.config.HostAddress, &interpolate.Context{Data: generatedData})
+		if err != nil {
+			return "", fmt.Errorf("failed to render host_address: %w", err)
+		}
+		address = normalizeAddress(address)
+		if address == "" || strings.Contains(address, "<no value>") {
+			return "", fmt.Errorf("host_address %q did not render to an address", p.config.HostAddress)
+		}
+		return address, nil
+	}
+
+	key, ok := config.HostAddressSources[p.config.HostAddressSource]
+	if !ok {
+		key = "Host"
+	}
+	address, _ := generatedData[key].(string)
+	if address == "" {
+		if key == "Host" {
+			return "localhost", nil
+		}
+		return "", fmt.Errorf("host_address_source is %s, but the builder did not export %s", p.config.HostAddressSource, key)
+	}
+	return normalizeAddress(address), nil
+}
+
+// normalizeAddress strips the brackets of an IPv6 literal, which Ansible
+// expects bare in ansible_host.
+func normalizeAddress(address string) string {
+	address = strings.TrimSpace(address)
+	if strings.HasPrefix(address, "[") && strings.HasSuffix(address, "]") {
+		return address[1 : len(address)-1]
+	}
+	return address
+}
+
+// connectionType returns how Ansible connects to the build VM: the connection
+// option if set, otherwise the communicator Packer used. Without ConnType in
+// the generated data, a WinRM password implies a WinRM connection.
+func (p *Provisioner) connectionType(generatedData map[string]interface{}) string {
+	if p.config.Connection != "" {
+		return p.config.Connection
+	}
+	switch connType, _ := generatedData["ConnType"].(string); connType {
+	case "ssh", "winrm":
+		return connType
+	}
+	if winrmPassword, ok := generatedData["WinRMPassword"].(string); ok && winrmPassword != "" {
+		return "winrm"
+	}
+	return "ssh"
+}
+
+// winrmOptions maps the winrm_* options to WinRM connection settings. The
+// option names follow Packer's WinRM communicator, so builds can pass the
+// same values to both.
+func (p *Provisioner) winrmOptions() client.WinRMOptions {
+	opts := client.WinRMOptions{
+		Transport:         p.config.WinRMTransport,
+		CATrustPath:       p.config.WinRMCATrustPath,
+		MessageEncryption: p.config.WinRMMessageEncryption,
+		OperationTimeout:  p.config.WinRMOperationTimeout,
+		ReadTimeout:       p.config.WinRMReadTimeout,
+	}
+	if opts.Transport == "" && p.config.WinRMUseNTLM {
+		opts.Transport = "ntlm"
+	}
+
+	switch {
+	case p.config.WinRMUseSSL.True():
+		opts.Scheme = "https"
+	case p.config.WinRMUseSSL.False():
+		opts.Scheme = "http"
+	}
+
+	switch {
+	case p.config.WinRMInsecure.True():
+		opts.ServerCertValidation = "ignore"
+	case p.config.WinRMInsecure.False(), p.config.WinRMCATrustPath != "":
+		opts.ServerCertValidation = "validate"
+	}
+	return opts
+}
+
+// windowsShellType returns the shell type Ansible uses for a Windows host
+// reached over OpenSSH, or "" for other hosts. With os_type unset, the guest
+// is probed through the communicator.
+func (p *Provisioner) windowsShellType(ctx context.Context, ui packersdk.Ui, comm packersdk.Communicator) string {
+	switch p.config.OSType {
+	case "linux":
+		return ""
+	case "windows":
+		if p.config.WindowsShellType != "" {
+			return p.config.WindowsShellType
+		}
+	}
+	if comm == nil {
+		if p.config.OSType == "windows" {
+			return "powershell"
+		}
+		return ""
+	}
+
+	if p.config.OSType == "" {
+		out, err := runProbe(ctx, comm, "cmd /c ver")
+		if err != nil || !strings.Contains(out, "Microsoft Windows") {
+			return ""
+		}
+		ui.Message("🪟 Detected a Windows guest over SSH")
+		if p.config.WindowsShellType != "" {
+			return p.config.WindowsShellType
+		}
+	}
+
+	// cmd.exe expands %OS%, PowerShell prints it as is.
+	out, err := runProbe(ctx, comm, "echo %OS%")
+	if err == nil && strings.TrimSpace(out) == "Windows_NT" {
+		return "cmd"
+	}
+	return "powershell"
+}
+
+// runProbe runs a command on the guest and returns its output. A non-zero
+// exit status is reported as an error.
+func runProbe(ctx context.Context, comm packersdk.Communicator, command string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := &packersdk.RemoteCmd{Command: command, Stdout: &stdout, Stderr: io.Discard}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return "", err
+	}
+	if status := cmd.Wait(); status != 0 {
+		return "", fmt.Errorf("%q exited with status %d", command, status)
+	}
+	return stdout.String(), nil
+}
+
+// machineCredential builds the temporary Machine credential for the given
+// connection from the communicator's generated data, with explicit
+// configuration taking precedence. It also returns the credential type, which
+// is used in UI messages.
+func (p *Provisioner) machineCredential(username, connection string, generatedData map[string]interface{}) (client.MachineCredential, string, error) {
+	cred := client.MachineCredential{
+		Username:       username,
+		BecomeMethod:   p.config.BecomeMethod,
+		BecomeUsername: p.config.BecomeUsername,
+		BecomePassword: p.config.BecomePassword,
+	}
+
+	if connection == "winrm" {
+		password, _ := generatedData["WinRMPassword"].(string)
+		if password == "" {
+			password, _ = generatedData["Password"].(string)
+		}
+		if password == "" {
+			return cred, "", fmt.Errorf("no WinRM password found in generated data (WinRMPassword or Password)")
+		}
+		cred.Password = password
+		return cred, "winrm_password", nil
+	}
+
+	privateKey, _ := generatedData["SSHPrivateKey"].(string)
+	if p.config.SSHPrivateKeyFile != "" {
+		key, err := os.ReadFile(p.config.SSHPrivateKeyFile)
+		if err != nil {
+			return cred, "", fmt.Errorf("failed to read ssh_private_key_file: %w", err)
+		}
+		privateKey = string(key)
+	}
+	if privateKey != "" {
+		cred.SSHKeyData = privateKey
+		cred.SSHKeyUnlock = p.config.SSHKeyPassphrase
+		if p.config.SSHCertificateFile != "" {
+			cert, err := os.ReadFile(p.config.SSHCertificateFile)
+			if err != nil {
+				return cred, "", fmt.Errorf("failed to read ssh_certificate_file: %w", err)
+			}
+			cred.SSHPublicKeyData = string(cert)
+		}
+		return cred, "ssh_key", nil
+	}
+
+	if password, ok := generatedData["Password"].(string); ok && password != "" {
+		cred.Password = password
+		return cred, "ssh_password", nil
+	}
+
+	return cred, "", fmt.Errorf("no authentication method found in generated data (SSHPrivateKey or Password)")
+}
+
+// checkMachineCredential verifies that the job template, or one of the
+// configured additional credentials, provides a machine credential when
+// create_credential is false, and returns its ID. Ad hoc commands and
+// temporary job templates need one among the additional credentials. Workflow
+// templates are not checked, since each node brings its own credentials.
+func (p *Provisioner) checkMachineCredential(ctx context.Context, ui packersdk.Ui, templateCreds []client.Credential) (int, error) {
+	if p.config.WorkflowTemplateID != 0 && p.config.JobTemplateID == 0 {
+		ui.Message("ℹ️ create_credential is false, relying on the workflow's credentials")
+		return 0, nil
+	}
+
+	creds := slices.Clone(templateCreds)
+	for _, id := range p.config.CredentialIDs {
+		cred, err := p.client.GetCredential(ctx, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check credential_ids: %w", err)
+		}
+		creds = append(creds, cred)
+	}
+	for _, name := range p.config.CredentialNames {
+		cred, err := p.client.FindCredential(ctx, name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check credential_names: %w", err)
+		}
+		creds = append(creds, cred)
+	}
+
+	// Additional credentials replace the template's machine credential.
+	for _, cred := range slices.Backward(creds) {
+		if cred.Kind == "ssh" {
+			ui.Message(fmt.Sprintf("🔐 Using machine credential %s (ID: %d)", cred.Name, cred.ID))
+			return cred.ID, nil
+		}
+	}
+	if p.config.JobTemplateID == 0 {
+		return 0, errors.New("create_credential is false but credential_ids and credential_names include no machine credential")
+	}
+	return 0, fmt.Errorf("create_credential is false but job template %d has no machine credential; attach one to the template or set create_credential = true", p.config.JobTemplateID)
+}
+
+// createAdditionalHost adds a configured additional_host to the temporary
+// inventory and its groups. The host connects with its own user and password
+// host vars, not with the launch's machine credential.
+func (p *Provisioner) createAdditionalHost(ctx context.Context, ui packersdk.Ui, resources *ResourceIDs, extra config.AdditionalHost) error {
+	address := extra.Address
+	if address == "" {
+		address = extra.Name
+	}
+
+	ui.Message(fmt.Sprintf("🖥️ Adding additional host %s (%s) to inventory", extra.Name, address))
+	hostID, err := p.client.CreateHost(ctx, resources.InventoryID, client.HostDetails{
+		Name:     extra.Name,
+		Host:     normalizeAddress(address),
+		Port:     extra.Port,
+		Username: extra.User,
+		Password: extra.Password,
+		Vars:     extra.Vars,
+	})
+	if err != nil {
+		return err
+	}
+	resources.AdditionalHostIDs = append(resources.AdditionalHostIDs, hostID)
+	ui.Message(fmt.Sprintf("✅ Added host ID: %d", hostID))
+
+	return p.addToGroups(ctx, ui, resources, hostID, extra.Groups)
+}
+
+// addToGroups adds a host to the named groups of the temporary inventory,
+// creating each group with its group_vars the first time it is used.
+func (p *Provisioner) addToGroups(ctx context.Context, ui packersdk.Ui, resources *ResourceIDs, hostID int, groups []string) error {
+	for _, name := range groups {
+		groupID, ok := resources.GroupIDs[name]
+		if !ok {
+			var err error
+			groupID, err = p.client.CreateGroup(ctx, resources.InventoryID, name, p.config.GroupVars[name])
+			if err != nil {
+				return err
+			}
+			if resources.GroupIDs == nil {
+				resources.GroupIDs = make(map[string]int)
+			}
+			resources.GroupIDs[name] = groupID
+			ui.Message(fmt.Sprintf("✅ Created group %s with ID: %d", name, groupID))
+		}
+		if err := p.client.AddHostToGroup(ctx, groupID, hostID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSecretVarsCredential delivers secret_vars through a temporary
+// credential of a custom credential type, so AAP masks the values instead of
+// storing them in the job's extra_vars.
+func (p *Provisioner) createSecretVarsCredential(ctx context.Context, ui packersdk.Ui, resources *ResourceIDs) error {
+	keys := make([]string, 0, len(p.config.SecretVars))
+	inputs := make(map[string]interface{}, len(p.config.SecretVars))
+	for key, value := range p.config.SecretVars {
+		keys = append(keys, key)
+		inputs[key] = value
+	}
+
+	def := client.SecretVarsCredentialType(keys, p.config.SecretVarsInjector)
+	typeID, err := p.client.LookupCredentialType(ctx, def.Name, def.Kind)
+	switch {
+	case errors.Is(err, client.ErrCredentialTypeNotFound):
+		ui.Message(fmt.Sprintf("🔧 Registering credential type %s...", def.Name))
+		typeID, err = p.client.CreateCredentialType(ctx, def)
+		if err != nil {
+			return err
+		}
+		resources.SecretCredentialTypeCreated = true
+	case err != nil:
+		return err
+	default:
+		ui.Message(fmt.Sprintf("♻️ Reusing credential type %s (ID: %d)", def.Name, typeID))
+	}
+	resources.SecretCredentialTypeID = typeID
+
+	credentialID, err := p.client.CreateCustomCredential(ctx, p.config.OrganizationID, typeID, inputs)
+	if err != nil {
+		return err
+	}
+	resources.SecretCredentialID = credentialID
+	ui.Message(fmt.Sprintf("✅ Created secret vars credential ID: %d", credentialID))
+	return nil
+}
+
+// createJobTemplate creates a temporary job template that runs playbook from
+// the configured project against the temporary inventory.
+func (p *Provisioner) createJobTemplate(ctx context.Context, ui packersdk.Ui, resources *ResourceIDs) error {
+	projectID := p.config.ProjectID
+	if p.config.ProjectName != "" {
+		var err error
+		projectID, err = p.client.FindProject(ctx, p.config.ProjectName)
+		if err != nil {
+			return err
+		}
+	}
+
+	ui.Message(fmt.Sprintf("📝 Creating job template for playbook %s of project %d...", p.config.Playbook, projectID))
+	templateID, err := p.client.CreateJobTemplate(ctx, client.JobTemplate{
+		InventoryID:            resources.InventoryID,
+		ProjectID:              projectID,
+		Playbook:               p.config.Playbook,
+		ExecutionEnvironmentID: p.config.ExecutionEnvironmentID,
+		Timeout:                p.config.JobTimeout,
+	})
+	if err != nil {
+		return err
+	}
+	resources.JobTemplateID = templateID
+
+	for _, groupID := range p.config.InstanceGroupIDs {
+		if err := p.client.AddJobTemplateInstanceGroup(ctx, templateID, groupID); err != nil {
+			return err
+		}
+	}
+	ui.Message(fmt.Sprintf("✅ Created job template ID: %d", templateID))
+	return nil
+}
+
+// launchCredentials resolves the credentials to send at launch: the
+// template's default credentials, with the temporary credentials and any
+// configured credential_ids/credential_names replacing the defaults of the
+// same type. defaults are the template's credentials. It returns nil when
+// nothing overrides them.
+func (p *Provisioner) launchCredentials(ctx context.Context, ui packersdk.Ui, resources *ResourceIDs, defaults []client.Credential) ([]int, error) {
+	var overrides []client.Credential
+	if resources.CredentialID != 0 {
+		machineTypeID, err := p.client.LookupCredentialType(ctx, "Machine", "ssh")
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, client.Credential{
+			ID:               resources.CredentialID,
+			Name:             "temporary machine credential",
+			CredentialTypeID: machineTypeID,
+			Kind:             "ssh",
+		})
+	}
+	if resources.VaultCredentialID != 0 {
+		vaultTypeID, err := p.client.LookupCredentialType(ctx, "Vault", "vault")
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, client.Credential{
+			ID:               resources.VaultCredentialID,
+			Name:             "temporary vault credential",
+			CredentialTypeID: vaultTypeID,
+			Kind:             "vault",
+			VaultID:          p.config.VaultID,
+		})
+	}
+	if resources.SecretCredentialID != 0 {
+		overrides = append(overrides, client.Credential{
+			ID:               resources.SecretCredentialID,
+			Name:             "temporary secret vars credential",
+			CredentialTypeID: resources.SecretCredentialTypeID,
+			Kind:             "cloud",
+		})
+	}
+	for _, id := range p.config.CredentialIDs {
+		cred, err := p.client.GetCredential(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, cred)
+	}
+	for _, name := range p.config.CredentialNames {
+		cred, err := p.client.FindCredential(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, cred)
+	}
+	if len(overrides) == 0 {
+		return nil, nil
+	}
+
+	merged := client.MergeCredentials(defaults, overrides)
+	ids := make([]int, 0, len(merged))
+	ui.Message("🔐 Credentials for launch:")
+	for _, cred := range merged {
+		ui.Message(fmt.Sprintf("   • %s (ID: %d, kind: %s)", cred.Name, cred.ID, cred.Kind))
+		ids = append(ids, cred.ID)
+	}
+	return ids, nil
+}
+
 // cleanup performs cleanup of created resources in dependency-safe order.
 func (p *Provisioner) cleanup(ctx context.Context, ui packersdk.Ui, resources *ResourceIDs) {
-	// Cleanup in dependency-safe order: credential, host, inventory
-	if resources.CredentialID != 0 && !p.config.KeepTempCredential && p.config.CreateCredential {
+	// Cleanup in dependency-safe order: job template, credentials, host,
+	// inventory
+	if resources.JobTemplateID != 0 {
+		ui.Message(fmt.Sprintf("🧹 Cleaning up job template %d...", resources.JobTemplateID))
+		if err := p.client.DeleteJobTemplate(ctx, resources.JobTemplateID); err != nil {
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete job template: %s", describeError(err)))
+		}
+	}
+
+	if resources.CredentialID != 0 && !p.config.KeepTempCredential {
 		ui.Message(fmt.Sprintf("🧹 Cleaning up credential %d...", resources.CredentialID))
 		if err := p.client.DeleteCredential(ctx, resources.CredentialID); err != nil {
-			ui.Message(fmt.Sprintf("⚠️ Failed to delete credential: %s", err))
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete credential: %s", describeError(err)))
+		}
+	}
+
+	if resources.VaultCredentialID != 0 && !p.config.KeepTempCredential {
+		ui.Message(fmt.Sprintf("🧹 Cleaning up Vault credential %d...", resources.VaultCredentialID))
+		if err := p.client.DeleteCredential(ctx, resources.VaultCredentialID); err != nil {
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete Vault credential: %s", describeError(err)))
+		}
+	}
+
+	if resources.SecretCredentialID != 0 && !p.config.KeepTempCredential {
+		ui.Message(fmt.Sprintf("🧹 Cleaning up secret vars credential %d...", resources.SecretCredentialID))
+		if err := p.client.DeleteCredential(ctx, resources.SecretCredentialID); err != nil {
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete secret vars credential: %s", describeError(err)))
+		}
+	}
+
+	if resources.SecretCredentialTypeCreated && !p.config.KeepTempCredential {
+		ui.Message(fmt.Sprintf("🧹 Cleaning up credential type %d...", resources.SecretCredentialTypeID))
+		err := p.client.DeleteCredentialType(ctx, resources.SecretCredentialTypeID)
+		switch {
+		case client.IsConflict(err):
+			// Another build reused the type and still has a credential of it.
+			ui.Message(fmt.Sprintf("ℹ️ Credential type %d is still in use, leaving it in place", resources.SecretCredentialTypeID))
+		case err != nil:
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete credential type: %s", describeError(err)))
 		}
 	}
 
 	if resources.HostID != 0 {
 		ui.Message(fmt.Sprintf("🧹 Cleaning up host %d...", resources.HostID))
 		if err := p.client.DeleteHost(ctx, resources.HostID); err != nil {
-			ui.Message(fmt.Sprintf("⚠️ Failed to delete host: %s", err))
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete host: %s", describeError(err)))
+		}
+	}
+
+	for _, hostID := range resources.AdditionalHostIDs {
+		ui.Message(fmt.Sprintf("🧹 Cleaning up host %d...", hostID))
+		if err := p.client.DeleteHost(ctx, hostID); err != nil {
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete host: %s", describeError(err)))
+		}
+	}
+
+	groupNames := make([]string, 0, len(resources.GroupIDs))
+	for name := range resources.GroupIDs {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		ui.Message(fmt.Sprintf("🧹 Cleaning up group %s...", name))
+		if err := p.client.DeleteGroup(ctx, resources.GroupIDs[name]); err != nil {
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete group: %s", describeError(err)))
 		}
 	}
 
 	if resources.InventoryID != 0 && !p.config.KeepTempInventory {
 		ui.Message(fmt.Sprintf("🧹 Cleaning up inventory %d...", resources.InventoryID))
 		if err := p.client.DeleteInventory(ctx, resources.InventoryID); err != nil {
-			ui.Message(fmt.Sprintf("⚠️ Failed to delete inventory: %s", err))
+			ui.Message(fmt.Sprintf("⚠️ Failed to delete inventory: %s", describeError(err)))
 		}
 	}
 }